@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/service"
+	log "github.com/sirupsen/logrus"
+)
+
+func runCommand(args []string) int {
+	if args[0] != "config" || len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] config validate|print|schema\n", os.Args[0])
+		return 2
+	}
+	var err error
+	switch args[1] {
+	case "validate":
+		err = validateConfig()
+	case "print":
+		err = printConfig(args[2:])
+	case "schema":
+		err = printSchema()
+	default:
+		err = fmt.Errorf("unknown config command %v", args[1])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func validateConfig() error {
+	cr, err := config.LoadKoanfReader(configPath)
+	if err != nil {
+		return err
+	}
+	if svcs == nil {
+		svcs = supportedServices
+	}
+	_, err = service.NewSupervisor(config.WithReader[service.IService](cr))
+	_, tracingErr := newTracingService(config.WithReader[service.IService](cr))
+	err = errors.Join(err, tracingErr)
+	for _, svc := range svcs {
+		switch svc {
+		case "api":
+			_, svcErr := newApiService(config.WithReader[service.IService](cr))
+			err = errors.Join(err, svcErr)
+		case "generator":
+			_, svcErr := newGeneratorService(config.WithReader[service.IService](cr))
+			err = errors.Join(err, svcErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("config %s is valid", configPath)
+	return nil
+}
+
+func configSchema() (*config.Schema, error) {
+	schema := config.NewObjectSchema()
+	schema.Draft = config.SchemaDraft
+
+	apiSvc, err := newApiService()
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := apiSvc.(config.ISchemaProvider); ok {
+		schema.Properties["api"] = p.Schema()
+	}
+
+	generatorSvc, err := newGeneratorService()
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := generatorSvc.(config.ISchemaProvider); ok {
+		schema.Properties["generator"] = p.Schema()
+	}
+
+	tracingSvc, err := newTracingService()
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := tracingSvc.(config.ISchemaProvider); ok {
+		schema.Properties["tracing"] = p.Schema()
+	}
+
+	sv, err := service.NewSupervisor()
+	if err != nil {
+		return nil, err
+	}
+	schema.Properties["supervisor"] = sv.Schema()
+	return schema, nil
+}
+
+func printConfig(args []string) error {
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	format := fs.String("format", "yaml", "output format; yaml or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cr, err := config.LoadKoanfReader(configPath)
+	if err != nil {
+		return err
+	}
+	schema, err := configSchema()
+	if err != nil {
+		return err
+	}
+	m := cr.Map()
+	// sections of the services that run are shown with their defaults even
+	// when the config omits them
+	if svcs == nil {
+		svcs = supportedServices
+	}
+	sections := append([]string{"supervisor"}, svcs...)
+	if slices.Contains(svcs, "api") {
+		sections = append(sections, "tracing")
+	}
+	for _, section := range sections {
+		if _, ok := m[section]; !ok {
+			m[section] = map[string]any{}
+		}
+	}
+	effective := config.Redact(config.ApplyDefaults(schema, m))
+
+	var out []byte
+	switch *format {
+	case "json":
+		out, err = json.MarshalIndent(effective, "", "  ")
+	default:
+		out, err = config.Marshal(effective, *format)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func printSchema() error {
+	schema, err := configSchema()
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -9,12 +9,14 @@ import (
 	"slices"
 	"strings"
 	"syscall"
-	"time"
 
 	"example.com/analytics_api/internal/api"
 	"example.com/analytics_api/internal/events"
+	"example.com/analytics_api/internal/generator"
 	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/middleware"
 	"example.com/analytics_api/pkg/service"
+	"example.com/analytics_api/pkg/tracing"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -26,6 +28,7 @@ const (
 var (
 	configPath        string
 	logLevel          string
+	logFormat         string
 	svcs              servicesSlice
 	supportedServices = []string{"api", "generator"}
 )
@@ -56,6 +59,12 @@ func init() {
 		log.InfoLevel.String(),
 		"logging level",
 	)
+	flag.StringVar(
+		&logFormat,
+		"log-format",
+		"text",
+		"logging format; text or json",
+	)
 	flag.Var(
 		&svcs,
 		"service",
@@ -66,17 +75,30 @@ func init() {
 func main() {
 	flag.Parse()
 
-	log.SetFormatter(
-		&log.TextFormatter{
-			DisableColors: true,
-		},
-	)
+	switch logFormat {
+	case "text":
+		log.SetFormatter(
+			config.NewRedactingFormatter(
+				&log.TextFormatter{
+					DisableColors: true,
+				},
+			),
+		)
+	case "json":
+		log.SetFormatter(config.NewRedactingFormatter(&log.JSONFormatter{}))
+	default:
+		log.Fatalf("unknown log format %v", logFormat)
+	}
 	level, err := log.ParseLevel(logLevel)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.SetLevel(level)
 
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -86,31 +108,97 @@ func main() {
 		svcs = supportedServices
 	}
 
-	run := make([]service.IService, 0)
+	sv, err := service.NewSupervisor(
+		service.WithLogger(log.StandardLogger()),
+		config.WithReader[service.IService](cr),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if slices.Contains(svcs, "api") {
+		tr, err := newTracingService(config.WithReader[service.IService](cr))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := sv.Add("tracing", tr); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var gen service.IService
 	for _, svc := range svcs {
 		switch svc {
 		case "api":
-			s, err := api.NewService(
-				service.WithLogger(log.StandardLogger()),
-				api.WithHandlerFactory("events", events.NewHandler),
-				config.WithReader[service.IService](cr),
-			)
+			s, err := newApiService(config.WithReader[service.IService](cr))
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = sv.Add(svc, s, "tracing")
 			if err != nil {
 				log.Fatal(err)
 			}
-			run = append(run, s)
 		case "generator":
-			go generator(ctx, cr)
+			s, err := newGeneratorService(config.WithReader[service.IService](cr))
+			if err != nil {
+				log.Fatal(err)
+			}
+			gen = s
+			err = sv.Add(svc, s)
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
 
-	for _, svc := range run {
-		go svc.Run()
+	go func() {
+		<-ctx.Done()
+		sv.Stop(context.Background())
+	}()
+	if err := sv.Run(); err != nil {
+		log.Fatal(err)
 	}
-	<-ctx.Done()
-	for _, svc := range run {
-		ctx, stop := context.WithTimeout(context.Background(), 3*time.Second)
-		defer stop()
-		svc.Stop(ctx)
+	// a generator-only run is a load test, its SLO verdict is the exit status
+	if p, ok := gen.(generator.IVerdictProvider); ok && len(svcs) == 1 {
+		if err := p.Verdict(); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
+
+func newApiService(opts ...service.Opt) (service.IService, error) {
+	return api.NewService(
+		append(
+			[]service.Opt{
+				service.WithLogger(log.StandardLogger()),
+				api.WithHandlerFactory("events", events.NewHandler),
+				api.WithMiddlewareFactory(middleware.Cors, middleware.NewCors),
+				api.WithMiddlewareFactory(middleware.Limiter, middleware.NewLimiter),
+				api.WithMiddlewareFactory(middleware.BodyLimit, middleware.NewBodyLimit),
+				api.WithMiddlewareFactory(middleware.Compress, middleware.NewCompress),
+				api.WithMiddlewareFactory(middleware.KeyAuth, middleware.NewKeyAuth),
+			},
+			opts...,
+		)...,
+	)
+}
+
+func newGeneratorService(opts ...service.Opt) (service.IService, error) {
+	return generator.NewService(
+		append(
+			[]service.Opt{
+				service.WithLogger(log.StandardLogger()),
+			},
+			opts...,
+		)...,
+	)
+}
+
+func newTracingService(opts ...service.Opt) (service.IService, error) {
+	return tracing.NewService(
+		append(
+			[]service.Opt{
+				service.WithLogger(log.StandardLogger()),
+			},
+			opts...,
+		)...,
+	)
+}
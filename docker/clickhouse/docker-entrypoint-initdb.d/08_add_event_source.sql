@@ -0,0 +1,2 @@
+ALTER TABLE default.demo_events ADD COLUMN IF NOT EXISTS source LowCardinality(String) DEFAULT '';
+ALTER TABLE default.demo_events_buff ADD COLUMN IF NOT EXISTS source LowCardinality(String) DEFAULT '';
@@ -0,0 +1,49 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"example.com/analytics_api/pkg/handler"
+	"example.com/analytics_api/pkg/openapi"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	docsTitle   = "analytics_api"
+	docsVersion = "1.0"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// buildOpenAPI merges the routes of all documented handlers, mounted under
+// their paths and tagged with the handler name.
+func buildOpenAPI(handlers map[string]handler.IHandler) *openapi.Document {
+	doc := openapi.NewDocument(docsTitle, docsVersion)
+	for _, name := range slices.Sorted(maps.Keys(handlers)) {
+		h := handlers[name]
+		if d, ok := h.(handler.IDocumenter); ok {
+			doc.Add(h.Path(), name, d.Routes())
+		}
+	}
+	return doc
+}
+
+func (s *apiService) addDocsRoutes(r fiber.Router, doc *openapi.Document) error {
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	r.Get("/openapi.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(spec)
+	})
+	r.Get("/docs", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.Send(docsPage)
+	})
+	return nil
+}
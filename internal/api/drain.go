@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/handler"
+)
+
+type DrainConfig struct {
+	PreStopDelay    time.Duration `config:"pre_stop_delay"`
+	ShutdownTimeout time.Duration `config:"shutdown_timeout"`
+	FlushTimeout    time.Duration `config:"flush_timeout"`
+	CloseTimeout    time.Duration `config:"close_timeout"`
+}
+
+func NewDrainConfig() *DrainConfig {
+	return &DrainConfig{
+		ShutdownTimeout: 10 * time.Second,
+		FlushTimeout:    5 * time.Second,
+		CloseTimeout:    5 * time.Second,
+	}
+}
+
+func (c *DrainConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	for key, target := range map[string]*time.Duration{
+		"pre_stop_delay":   &newC.PreStopDelay,
+		"shutdown_timeout": &newC.ShutdownTimeout,
+		"flush_timeout":    &newC.FlushTimeout,
+		"close_timeout":    &newC.CloseTimeout,
+	} {
+		v, vErr := config.GetDuration(cr, key)
+		if vErr != nil && !errors.Is(vErr, config.ErrNotFound) {
+			err = errors.Join(err, vErr)
+		} else if vErr == nil {
+			*target = v
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+// drain stops the service in phases, each bounded by its own timeout:
+// readiness is already off when it is called, so load balancers get
+// PreStopDelay to notice, then the listener is closed and in-flight requests
+// are awaited, then handlers flush buffered events and are stopped.
+func (s *apiService) drain(ctx context.Context) error {
+	s.logger.Info("drain: readiness is off")
+	if s.c.Drain.PreStopDelay > 0 {
+		s.logger.Infof("drain: waiting %s before closing listeners", s.c.Drain.PreStopDelay)
+		select {
+		case <-time.After(s.c.Drain.PreStopDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	err := s.drainPhase(ctx, "shutdown", s.c.Drain.ShutdownTimeout, s.app.ShutdownWithContext)
+	err = errors.Join(err, s.drainPhase(ctx, "flush", s.c.Drain.FlushTimeout, s.flushHandlers))
+	err = errors.Join(err, s.drainPhase(ctx, "close", s.c.Drain.CloseTimeout, s.stopHandlers))
+	return err
+}
+
+func (s *apiService) drainPhase(ctx context.Context, name string, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	if err := fn(ctx); err != nil {
+		s.logger.WithError(err).Errorf("drain: %s failed after %s", name, time.Since(start))
+		return fmt.Errorf("drain %s: %w", name, err)
+	}
+	s.logger.Infof("drain: %s done in %s", name, time.Since(start))
+	return nil
+}
+
+func (s *apiService) flushHandlers(ctx context.Context) error {
+	var err error
+	for _, name := range slices.Sorted(maps.Keys(s.handlers)) {
+		if f, ok := s.handlers[name].(handler.IFlusher); ok {
+			if flushErr := f.Flush(ctx); flushErr != nil {
+				err = errors.Join(err, fmt.Errorf("handler %s: %w", name, flushErr))
+			}
+		}
+	}
+	return err
+}
+
+// stopHandlers stops handlers in the background, so one that ignores the
+// context can not hold the service past the timeout.
+func (s *apiService) stopHandlers(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for _, name := range slices.Sorted(maps.Keys(s.handlers)) {
+			if stopper, ok := s.handlers[name].(handler.IStopper); ok {
+				if stopErr := stopper.Stop(ctx); stopErr != nil {
+					err = errors.Join(err, fmt.Errorf("handler %s: %w", name, stopErr))
+				}
+			}
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type drainedHandler struct {
+	calls     []string
+	stopDelay time.Duration
+}
+
+func (h *drainedHandler) Path() string {
+	return "/drained"
+}
+
+func (h *drainedHandler) AddRoutes(fiber.Router) {}
+
+func (h *drainedHandler) Flush(context.Context) error {
+	h.calls = append(h.calls, "flush")
+	return nil
+}
+
+func (h *drainedHandler) Stop(context.Context) error {
+	time.Sleep(h.stopDelay)
+	h.calls = append(h.calls, "stop")
+	return nil
+}
+
+func TestService_Drain(t *testing.T) {
+	h := &drainedHandler{}
+	s := &apiService{
+		c:        NewConfig(),
+		logger:   log.New(),
+		app:      fiber.New(),
+		handlers: map[string]handler.IHandler{"drained": h},
+	}
+	s.c.Drain.PreStopDelay = 50 * time.Millisecond
+
+	start := time.Now()
+	assert.NoError(t, s.Stop(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), s.c.Drain.PreStopDelay)
+	assert.True(t, s.stopping.Load())
+	assert.Equal(t, []string{"flush", "stop"}, h.calls)
+}
+
+func TestService_DrainTimeout(t *testing.T) {
+	h := &drainedHandler{stopDelay: time.Second}
+	s := &apiService{
+		c:        NewConfig(),
+		logger:   log.New(),
+		app:      fiber.New(),
+		handlers: map[string]handler.IHandler{"drained": h},
+	}
+	s.c.Drain.CloseTimeout = 10 * time.Millisecond
+
+	err := s.Stop(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "drain close")
+}
+
+func TestService_StopTimeout(t *testing.T) {
+	s := &apiService{c: NewConfig()}
+	assert.Equal(t, 20*time.Second, s.StopTimeout())
+	s.c.Drain.PreStopDelay = 2 * time.Second
+	assert.Equal(t, 22*time.Second, s.StopTimeout())
+}
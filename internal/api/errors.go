@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorResponse maps an error returned by a handler or middleware onto the
+// response status and body; only handler errors carry a specific code and
+// field errors, other non fiber errors are reported as internal.
+func errorResponse(err error) (int, handler.ErrorResponse) {
+	var (
+		handlerErr *handler.Error
+		fiberErr   *fiber.Error
+	)
+	switch {
+	case errors.As(err, &handlerErr):
+		return handlerErr.Status, handler.ErrorResponse{
+			Code:    handlerErr.Code,
+			Message: handlerErr.Message,
+			Fields:  handlerErr.Fields,
+		}
+	case errors.As(err, &fiberErr):
+		return fiberErr.Code, handler.ErrorResponse{
+			Code:    handler.CodeOf(fiberErr.Code),
+			Message: fiberErr.Message,
+		}
+	}
+	return fiber.StatusInternalServerError, handler.ErrorResponse{
+		Code:    handler.CodeInternalError,
+		Message: "internal server error",
+	}
+}
+
+func (s *apiService) errorHandler(c *fiber.Ctx, err error) error {
+	status, resp := errorResponse(err)
+	if id, ok := c.Locals(requestIdKey).(string); ok {
+		resp.RequestID = id
+	}
+	if status >= fiber.StatusInternalServerError {
+		s.logger.WithFields(contextFields(c.Context())).WithError(err).Error("request failed")
+	}
+	return c.Status(status).JSON(resp)
+}
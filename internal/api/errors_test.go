@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ErrorHandler(t *testing.T) {
+	s := newTestService()
+	s.app.Use(requestid.New(requestid.Config{ContextKey: requestIdKey}))
+	s.app.Get("/invalid", func(c *fiber.Ctx) error {
+		err := handler.NewError(fiber.StatusBadRequest, handler.CodeValidationFailed, "event is invalid", errors.New("cause"))
+		err.Fields = []handler.FieldError{{Field: "dt", Rule: "required", Message: "dt is required"}}
+		return err
+	})
+	s.app.Get("/teapot", func(c *fiber.Ctx) error {
+		return fiber.ErrTeapot
+	})
+	s.app.Get("/panic", func(c *fiber.Ctx) error {
+		return errors.New("dial tcp 10.0.0.1:9000: connection refused")
+	})
+
+	for path, expected := range map[string]struct {
+		status int
+		resp   handler.ErrorResponse
+	}{
+		"/invalid": {fiber.StatusBadRequest, handler.ErrorResponse{
+			Code:    handler.CodeValidationFailed,
+			Message: "event is invalid",
+			Fields:  []handler.FieldError{{Field: "dt", Rule: "required", Message: "dt is required"}},
+		}},
+		"/teapot":  {fiber.StatusTeapot, handler.ErrorResponse{Code: "i_m_a_teapot", Message: "I'm a teapot"}},
+		"/panic":   {fiber.StatusInternalServerError, handler.ErrorResponse{Code: handler.CodeInternalError, Message: "internal server error"}},
+		"/missing": {fiber.StatusNotFound, handler.ErrorResponse{Code: "not_found", Message: "Cannot GET /missing"}},
+	} {
+		resp, err := s.app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		require.NoError(t, err)
+		assert.Equal(t, expected.status, resp.StatusCode, path)
+		assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get(fiber.HeaderContentType), path)
+
+		body := handler.ErrorResponse{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, resp.Header.Get(fiber.HeaderXRequestID), body.RequestID, path)
+		assert.NotEmpty(t, body.RequestID, path)
+		body.RequestID = ""
+		assert.Equal(t, expected.resp, body, path)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	healthOk       = "ok"
+	healthFailed   = "failed"
+	healthStarting = "starting"
+	healthStopping = "stopping"
+)
+
+func (s *apiService) healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": healthOk})
+}
+
+// readyz reports whether the service should receive traffic: it is not ready
+// until it listens, once shutdown has begun, or while any handler check fails.
+func (s *apiService) readyz(c *fiber.Ctx) error {
+	switch {
+	case s.stopping.Load():
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": healthStopping})
+	case !s.serving.Load():
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": healthStarting})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), s.c.ReadinessTimeout)
+	defer cancel()
+	checks, ok := s.checkHealth(ctx)
+	if !ok {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": healthFailed, "checks": checks})
+	}
+	return c.JSON(fiber.Map{"status": healthOk, "checks": checks})
+}
+
+func (s *apiService) checkHealth(ctx context.Context) (map[string]string, bool) {
+	var (
+		m      sync.Mutex
+		wg     sync.WaitGroup
+		ok     = true
+		checks = make(map[string]string)
+	)
+	for _, name := range slices.Sorted(maps.Keys(s.handlers)) {
+		checker, isChecker := s.handlers[name].(handler.IHealthChecker)
+		if !isChecker {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := checker.CheckHealth(ctx)
+			m.Lock()
+			defer m.Unlock()
+			if err != nil {
+				s.logger.WithError(err).Warnf("handler %s is not ready", name)
+				checks[name] = healthFailed
+				ok = false
+			} else {
+				checks[name] = healthOk
+			}
+		}()
+	}
+	wg.Wait()
+	return checks, ok
+}
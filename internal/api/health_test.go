@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type checkedHandler struct {
+	err error
+}
+
+func (h *checkedHandler) Path() string {
+	return "/checked"
+}
+
+func (h *checkedHandler) AddRoutes(fiber.Router) {}
+
+func (h *checkedHandler) CheckHealth(context.Context) error {
+	return h.err
+}
+
+func TestService_Readyz(t *testing.T) {
+	checked := &checkedHandler{}
+	s := &apiService{
+		c:      NewConfig(),
+		logger: log.New(),
+		handlers: map[string]handler.IHandler{
+			"checked": checked,
+		},
+	}
+	app := fiber.New()
+	app.Get("/healthz", s.healthz)
+	app.Get("/readyz", s.readyz)
+
+	probe := func(path string) (int, map[string]any) {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		require.NoError(t, err)
+		body := map[string]any{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	code, body := probe("/healthz")
+	assert.Equal(t, fiber.StatusOK, code)
+	assert.Equal(t, healthOk, body["status"])
+
+	code, body = probe("/readyz")
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, healthStarting, body["status"])
+
+	s.serving.Store(true)
+	code, body = probe("/readyz")
+	assert.Equal(t, fiber.StatusOK, code)
+	assert.Equal(t, map[string]any{"checked": healthOk}, body["checks"])
+
+	checked.err = errors.New("clickhouse is down")
+	code, body = probe("/readyz")
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, healthFailed, body["status"])
+	assert.Equal(t, map[string]any{"checked": healthFailed}, body["checks"])
+
+	checked.err = nil
+	s.stopping.Store(true)
+	code, body = probe("/readyz")
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, healthStopping, body["status"])
+
+	code, _ = probe("/healthz")
+	assert.Equal(t, fiber.StatusOK, code)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+
+	"example.com/analytics_api/pkg/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const unixPrefix = "unix:"
+
+type ListenerConfig struct {
+	Addr string    `config:"addr"`
+	TLS  TLSConfig `config:"tls"`
+}
+
+func (c *ListenerConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	addr, addrErr := config.Get[string](cr, "addr")
+	err = errors.Join(err, addrErr)
+	if addrErr == nil {
+		newC.Addr = addr
+	}
+
+	tlsCr, tlsErr := config.Sub(cr, "tls")
+	if tlsErr != nil && !errors.Is(tlsErr, config.ErrNotFound) {
+		err = errors.Join(err, tlsErr)
+	} else if tlsErr == nil {
+		err = errors.Join(err, newC.TLS.Read(tlsCr))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+func readListeners(cr config.IReader, key string) ([]ListenerConfig, error) {
+	rawListeners, err := config.GetList[map[string]any](cr, key)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]ListenerConfig, len(rawListeners))
+	for i, rawListener := range rawListeners {
+		if listenerErr := listeners[i].Read(config.NewMapReader(rawListener)); listenerErr != nil {
+			err = errors.Join(err, fmt.Errorf("listener %d: %w", i, listenerErr))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return listeners, nil
+}
+
+type AdminConfig struct {
+	Addr       string `config:"addr"`
+	Pprof      bool   `config:"pprof"`
+	ConfigDump bool   `config:"config_dump"`
+}
+
+func (c *AdminConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	addr, addrErr := config.Get[string](cr, "addr")
+	if addrErr != nil && !errors.Is(addrErr, config.ErrNotFound) {
+		err = errors.Join(err, addrErr)
+	} else if addrErr == nil {
+		newC.Addr = addr
+	}
+
+	pprof, pprofErr := config.Get[bool](cr, "pprof")
+	if pprofErr != nil && !errors.Is(pprofErr, config.ErrNotFound) {
+		err = errors.Join(err, pprofErr)
+	} else if pprofErr == nil {
+		newC.Pprof = pprof
+	}
+
+	configDump, configDumpErr := config.Get[bool](cr, "config_dump")
+	if configDumpErr != nil && !errors.Is(configDumpErr, config.ErrNotFound) {
+		err = errors.Join(err, configDumpErr)
+	} else if configDumpErr == nil {
+		newC.ConfigDump = configDump
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+func (c *AdminConfig) Enabled() bool {
+	return c.Addr != ""
+}
+
+// listen opens a TCP listener, or a Unix socket for addresses prefixed with
+// "unix:", and wraps it in TLS if the listener has a certificate.
+func listen(c ListenerConfig, logger *log.Logger) (net.Listener, error) {
+	network, addr := "tcp", c.Addr
+	if path, ok := strings.CutPrefix(c.Addr, unixPrefix); ok {
+		network, addr = "unix", path
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if !c.TLS.Enabled() {
+		return ln, nil
+	}
+	reloader, err := newCertReloader(&c.TLS, logger)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return tls.NewListener(ln, reloader.TLSConfig()), nil
+}
+
+// removeStaleSocket removes a socket left by a previous run; anything else
+// at the path is an error, so a mistyped address can not delete a file.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
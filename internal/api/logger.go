@@ -5,19 +5,96 @@ import (
 	"fmt"
 	"io"
 	"slices"
+	"time"
 
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
 	fiberlog "github.com/gofiber/fiber/v2/log"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
+type logContextKey int
+
+const (
+	requestIdKey logContextKey = iota
+	fiberCtxKey
+	handlerNameKey
+)
+
+func logContext(c *fiber.Ctx) error {
+	c.Locals(fiberCtxKey, c)
+	return c.Next()
+}
+
+func handlerLogContext(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(handlerNameKey, name)
+		return c.Next()
+	}
+}
+
+func contextFields(ctx context.Context) log.Fields {
+	fields := log.Fields{}
+	if ctx == nil {
+		return fields
+	}
+	if c, ok := ctx.Value(fiberCtxKey).(*fiber.Ctx); ok {
+		fields["route"] = c.Route().Path
+		fields["client_ip"] = c.IP()
+		if subject := handler.ClientSubject(c); subject != "" {
+			fields["client_subject"] = subject
+		}
+		if sc := trace.SpanContextFromContext(c.UserContext()); sc.IsValid() {
+			fields["trace_id"] = sc.TraceID().String()
+		}
+	}
+	if id, ok := ctx.Value(requestIdKey).(string); ok {
+		fields["request_id"] = id
+	}
+	if name, ok := ctx.Value(handlerNameKey).(string); ok {
+		fields["handler"] = name
+	}
+	return fields
+}
+
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	status, _ := errorResponse(err)
+	return status
+}
+
+func accessLog(l *log.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		status := responseStatus(c, err)
+		l.WithFields(contextFields(c.Context())).WithFields(log.Fields{
+			"method":  c.Method(),
+			"path":    c.Path(),
+			"status":  status,
+			"latency": time.Since(start).String(),
+			"bytes":   len(c.Response().Body()),
+		}).Info("access")
+		return err
+	}
+}
+
 type logger struct {
-	l *log.Logger
+	l      *log.Logger
+	fields log.Fields
 }
 
 var _ fiberlog.AllLogger = (*logger)(nil)
 
+func (l *logger) entry() *log.Entry {
+	return log.NewEntry(l.l).WithFields(l.fields)
+}
+
 func (l *logger) newEntryW(args ...any) *log.Entry {
-	e := log.NewEntry(l.l)
+	e := l.entry()
 	if len(args) > 0 {
 		if (len(args) & 1) == 1 {
 			args = append(args, "__KEYVALS_UNPAIRED__")
@@ -31,11 +108,11 @@ func (l *logger) newEntryW(args ...any) *log.Entry {
 }
 
 func (l *logger) Debug(args ...any) {
-	l.l.Debug(args...)
+	l.entry().Debug(args...)
 }
 
 func (l *logger) Debugf(format string, args ...any) {
-	l.l.Debugf(format, args...)
+	l.entry().Debugf(format, args...)
 }
 
 func (l *logger) Debugw(format string, args ...any) {
@@ -44,11 +121,11 @@ func (l *logger) Debugw(format string, args ...any) {
 }
 
 func (l *logger) Error(args ...any) {
-	l.l.Error(args...)
+	l.entry().Error(args...)
 }
 
 func (l *logger) Errorf(format string, args ...any) {
-	l.l.Errorf(format, args...)
+	l.entry().Errorf(format, args...)
 }
 
 func (l *logger) Errorw(format string, args ...any) {
@@ -57,11 +134,11 @@ func (l *logger) Errorw(format string, args ...any) {
 }
 
 func (l *logger) Fatal(args ...any) {
-	l.l.Fatal(args...)
+	l.entry().Fatal(args...)
 }
 
 func (l *logger) Fatalf(format string, args ...any) {
-	l.l.Fatalf(format, args...)
+	l.entry().Fatalf(format, args...)
 }
 
 func (l *logger) Fatalw(format string, args ...any) {
@@ -70,11 +147,11 @@ func (l *logger) Fatalw(format string, args ...any) {
 }
 
 func (l *logger) Info(args ...any) {
-	l.l.Info(args...)
+	l.entry().Info(args...)
 }
 
 func (l *logger) Infof(format string, args ...any) {
-	l.l.Infof(format, args...)
+	l.entry().Infof(format, args...)
 }
 
 func (l *logger) Infow(format string, args ...any) {
@@ -83,11 +160,11 @@ func (l *logger) Infow(format string, args ...any) {
 }
 
 func (l *logger) Panic(args ...any) {
-	l.l.Panic(args...)
+	l.entry().Panic(args...)
 }
 
 func (l *logger) Panicf(format string, args ...any) {
-	l.l.Panicf(format, args...)
+	l.entry().Panicf(format, args...)
 }
 
 func (l *logger) Panicw(format string, args ...any) {
@@ -96,11 +173,11 @@ func (l *logger) Panicw(format string, args ...any) {
 }
 
 func (l *logger) Trace(args ...any) {
-	l.l.Trace(args...)
+	l.entry().Trace(args...)
 }
 
 func (l *logger) Tracef(format string, args ...any) {
-	l.l.Tracef(format, args...)
+	l.entry().Tracef(format, args...)
 }
 
 func (l *logger) Tracew(format string, args ...any) {
@@ -109,11 +186,11 @@ func (l *logger) Tracew(format string, args ...any) {
 }
 
 func (l *logger) Warn(args ...any) {
-	l.l.Warn(args...)
+	l.entry().Warn(args...)
 }
 
 func (l *logger) Warnf(format string, args ...any) {
-	l.l.Warnf(format, args...)
+	l.entry().Warnf(format, args...)
 }
 
 func (l *logger) Warnw(format string, args ...any) {
@@ -132,5 +209,5 @@ func (l *logger) SetOutput(out io.Writer) {
 }
 
 func (l *logger) WithContext(ctx context.Context) fiberlog.CommonLogger {
-	return l
+	return &logger{l: l.l, fields: contextFields(ctx)}
 }
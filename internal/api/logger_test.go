@@ -0,0 +1,46 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	fiberlog "github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger_WithContext(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := log.New()
+	l.SetOutput(out)
+	l.SetFormatter(&log.JSONFormatter{})
+	fiberlog.SetLogger(&logger{l: l})
+
+	app := fiber.New()
+	app.Use(requestid.New(requestid.Config{ContextKey: requestIdKey}), logContext)
+	app.Group("/events", handlerLogContext("events")).Post("/", func(c *fiber.Ctx) error {
+		fiberlog.WithContext(c.Context()).Errorw("request insert error", "error", "test")
+		return nil
+	})
+
+	req := httptest.NewRequest(fiber.MethodPost, "/events/", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "abc-123")
+	resp, err := app.Test(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "abc-123", resp.Header.Get(fiber.HeaderXRequestID))
+	}
+
+	entry := map[string]any{}
+	if assert.NoError(t, json.Unmarshal(out.Bytes(), &entry)) {
+		assert.Equal(t, "abc-123", entry["request_id"])
+		assert.Equal(t, "events", entry["handler"])
+		assert.Equal(t, "/events/", entry["route"])
+		assert.Equal(t, "0.0.0.0", entry["client_ip"])
+		assert.Equal(t, "test", entry["error"])
+		assert.Equal(t, "request insert error", entry["msg"])
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/middleware"
+	"example.com/analytics_api/pkg/registry"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tagMiddleware(cr config.IReader) (fiber.Handler, error) {
+	tag, err := config.Get[string](cr, "tag")
+	if err != nil {
+		tag = "default"
+	}
+	return func(c *fiber.Ctx) error {
+		c.Append("X-Tags", tag)
+		return c.Next()
+	}, nil
+}
+
+func TestService_BuildMiddlewares(t *testing.T) {
+	s := &apiService{middlewaresF: registry.NewRegistry[middleware.Constructor]()}
+	require.NoError(t, s.RegisterMiddleware("tag", tagMiddleware))
+
+	mws, err := s.buildMiddlewares(config.NewMapReader(map[string]any{
+		"middlewares": []any{
+			"tag",
+			map[string]any{"name": "tag", "tag": "second"},
+		},
+	}))
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Group("/tagged", mws...).Get("/", func(c *fiber.Ctx) error { return nil })
+	app.Get("/plain", func(c *fiber.Ctx) error { return nil })
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/tagged/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "default, second", resp.Header.Get("X-Tags"))
+
+	resp, err = app.Test(httptest.NewRequest(fiber.MethodGet, "/plain", nil))
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get("X-Tags"))
+
+	mws, err = s.buildMiddlewares(config.NewMapReader(map[string]any{}))
+	assert.NoError(t, err)
+	assert.Empty(t, mws)
+
+	_, err = s.buildMiddlewares(config.NewMapReader(map[string]any{"middlewares": []any{"unknown"}}))
+	assert.Error(t, err)
+	_, err = s.buildMiddlewares(config.NewMapReader(map[string]any{"middlewares": []any{map[string]any{"tag": "x"}}}))
+	assert.ErrorIs(t, err, config.ErrNotFound)
+}
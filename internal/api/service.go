@@ -4,14 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"example.com/analytics_api/pkg/config"
 	"example.com/analytics_api/pkg/handler"
+	"example.com/analytics_api/pkg/middleware"
 	"example.com/analytics_api/pkg/registry"
 	"example.com/analytics_api/pkg/service"
 	"github.com/ansrivas/fiberprometheus/v2"
 	"github.com/gofiber/fiber/v2"
 	fiberlog "github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -24,13 +34,44 @@ func WithHandlerFactory(name string, h handler.Constructor) service.Opt {
 	}
 }
 
+func WithMiddlewareFactory(name string, m middleware.Constructor) service.Opt {
+	return func(s service.IService) error {
+		if i, ok := s.(middleware.IFactory); ok {
+			return i.RegisterMiddleware(name, m)
+		}
+		return nil
+	}
+}
+
 type Config struct {
-	Addr string
+	Addr             string           `config:"addr"`
+	AccessLog        bool             `config:"access_log"`
+	Docs             bool             `config:"docs"`
+	StartTimeout     time.Duration    `config:"start_timeout"`
+	ReadinessTimeout time.Duration    `config:"readiness_timeout"`
+	Drain            DrainConfig      `config:"drain"`
+	TLS              TLSConfig        `config:"tls"`
+	Listeners        []ListenerConfig `config:"listeners"`
+	Admin            AdminConfig      `config:"admin"`
+}
+
+// PublicListeners returns the configured listeners, or a single one built from
+// addr and tls when the list is empty.
+func (c *Config) PublicListeners() []ListenerConfig {
+	if len(c.Listeners) > 0 {
+		return c.Listeners
+	}
+	return []ListenerConfig{{Addr: c.Addr, TLS: c.TLS}}
 }
 
 func NewConfig() *Config {
 	return &Config{
-		Addr: ":8080",
+		Addr:             ":8080",
+		AccessLog:        true,
+		Docs:             true,
+		StartTimeout:     10 * time.Second,
+		ReadinessTimeout: 2 * time.Second,
+		Drain:            *NewDrainConfig(),
 	}
 }
 
@@ -45,6 +86,62 @@ func (c *Config) Read(cr config.IReader) error {
 		newC.Addr = addr
 	}
 
+	accessLog, accessLogErr := config.Get[bool](cr, "access_log")
+	if accessLogErr != nil && !errors.Is(accessLogErr, config.ErrNotFound) {
+		err = errors.Join(err, accessLogErr)
+	} else if accessLogErr == nil {
+		newC.AccessLog = accessLog
+	}
+
+	docs, docsErr := config.Get[bool](cr, "docs")
+	if docsErr != nil && !errors.Is(docsErr, config.ErrNotFound) {
+		err = errors.Join(err, docsErr)
+	} else if docsErr == nil {
+		newC.Docs = docs
+	}
+
+	startTimeout, startTimeoutErr := config.GetDuration(cr, "start_timeout")
+	if startTimeoutErr != nil && !errors.Is(startTimeoutErr, config.ErrNotFound) {
+		err = errors.Join(err, startTimeoutErr)
+	} else if startTimeoutErr == nil {
+		newC.StartTimeout = startTimeout
+	}
+
+	readinessTimeout, readinessTimeoutErr := config.GetDuration(cr, "readiness_timeout")
+	if readinessTimeoutErr != nil && !errors.Is(readinessTimeoutErr, config.ErrNotFound) {
+		err = errors.Join(err, readinessTimeoutErr)
+	} else if readinessTimeoutErr == nil {
+		newC.ReadinessTimeout = readinessTimeout
+	}
+
+	drainCr, drainErr := config.Sub(cr, "drain")
+	if drainErr != nil && !errors.Is(drainErr, config.ErrNotFound) {
+		err = errors.Join(err, drainErr)
+	} else if drainErr == nil {
+		err = errors.Join(err, newC.Drain.Read(drainCr))
+	}
+
+	tlsCr, tlsErr := config.Sub(cr, "tls")
+	if tlsErr != nil && !errors.Is(tlsErr, config.ErrNotFound) {
+		err = errors.Join(err, tlsErr)
+	} else if tlsErr == nil {
+		err = errors.Join(err, newC.TLS.Read(tlsCr))
+	}
+
+	listeners, listenersErr := readListeners(cr, "listeners")
+	if listenersErr != nil && !errors.Is(listenersErr, config.ErrNotFound) {
+		err = errors.Join(err, listenersErr)
+	} else if listenersErr == nil {
+		newC.Listeners = listeners
+	}
+
+	adminCr, adminErr := config.Sub(cr, "admin")
+	if adminErr != nil && !errors.Is(adminErr, config.ErrNotFound) {
+		err = errors.Join(err, adminErr)
+	} else if adminErr == nil {
+		err = errors.Join(err, newC.Admin.Read(adminCr))
+	}
+
 	if err != nil {
 		return err
 	}
@@ -55,22 +152,41 @@ func (c *Config) Read(cr config.IReader) error {
 }
 
 type apiService struct {
-	c         *Config
-	logger    *log.Logger
-	app       *fiber.App
-	handlersF registry.IRegistry[handler.Constructor]
+	c            *Config
+	logger       *log.Logger
+	app          *fiber.App
+	admin        *fiber.App
+	prometheus   *fiberprometheus.FiberPrometheus
+	dump         map[string]any
+	handlersF    registry.IRegistry[handler.Constructor]
+	middlewaresF registry.IRegistry[middleware.Constructor]
+	handlers     map[string]handler.IHandler
+	ready        chan struct{}
+	serving      atomic.Bool
+	stopping     atomic.Bool
 }
 
 func NewService(opts ...service.Opt) (service.IService, error) {
 	s := &apiService{
-		c:         NewConfig(),
-		logger:    log.StandardLogger(),
-		app:       fiber.New(),
-		handlersF: registry.NewRegistry[handler.Constructor](),
-	}
-	prometheus := fiberprometheus.New("analytics")
-	prometheus.RegisterAt(s.app, "/metrics")
-	s.app.Use(prometheus.Middleware)
+		c:            NewConfig(),
+		logger:       log.StandardLogger(),
+		handlersF:    registry.NewRegistry[handler.Constructor](),
+		middlewaresF: registry.NewRegistry[middleware.Constructor](),
+		handlers:     make(map[string]handler.IHandler),
+		ready:        make(chan struct{}),
+	}
+	s.app = fiber.New(fiber.Config{ErrorHandler: s.errorHandler})
+	var readyOnce sync.Once
+	s.app.Hooks().OnListen(func(fiber.ListenData) error {
+		s.serving.Store(true)
+		readyOnce.Do(func() { close(s.ready) })
+		return nil
+	})
+	s.prometheus = fiberprometheus.New("analytics")
+	s.app.Use(s.prometheus.Middleware)
+	s.app.Use(requestid.New(requestid.Config{ContextKey: requestIdKey}))
+	s.app.Use(traceRequest)
+	s.app.Use(logContext)
 	for _, opt := range opts {
 		if err := opt(s); err != nil {
 			return nil, err
@@ -102,6 +218,21 @@ func (s *apiService) Build(name string, opts ...handler.Opt) (handler.IHandler,
 	return c(opts...)
 }
 
+var _ middleware.IFactory = (*apiService)(nil)
+
+func (s *apiService) RegisterMiddleware(name string, c middleware.Constructor) error {
+	_, err := s.middlewaresF.Register(name, c)
+	return err
+}
+
+func (s *apiService) BuildMiddleware(name string, cr config.IReader) (fiber.Handler, error) {
+	c, err := s.middlewaresF.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return c(cr)
+}
+
 var _ config.IConfigurable = (*apiService)(nil)
 
 func (s *apiService) Configure(cr config.IReader) error {
@@ -112,38 +243,290 @@ func (s *apiService) Configure(cr config.IReader) error {
 	}
 	err = errors.Join(err, s.c.Read(apiCr))
 
-	handlers := make([]handler.IHandler, 0)
+	handlers := make(map[string]handler.IHandler)
+	middlewares := make(map[string][]fiber.Handler)
 	handlersCr, handlersErr := config.Sub(apiCr, "handlers")
 	err = errors.Join(err, handlersErr)
 	if handlersErr == nil {
-		for name := range handlersCr.Map() {
-			handlerCr, hadlerErr := config.Sub(handlersCr, name)
-			err = errors.Join(err, hadlerErr)
-			if err == nil {
-				handler, buildErr := s.Build(name, config.WithReader[handler.IHandler](handlerCr))
-				err = errors.Join(err, buildErr)
-				if buildErr == nil {
-					handlers = append(handlers, handler)
-				}
+		for _, name := range slices.Sorted(maps.Keys(handlersCr.Map())) {
+			handlerCr, handlerErr := config.Sub(handlersCr, name)
+			if handlerErr != nil {
+				err = errors.Join(err, handlerErr)
+				continue
 			}
-
+			handlerType, typeErr := config.Get[string](handlerCr, "type")
+			if errors.Is(typeErr, config.ErrNotFound) {
+				handlerType, typeErr = name, nil
+			}
+			if typeErr != nil {
+				err = errors.Join(err, fmt.Errorf("handler %s: %w", name, typeErr))
+				continue
+			}
+			handler, buildErr := s.Build(handlerType, config.WithReader[handler.IHandler](handlerCr))
+			if buildErr != nil {
+				err = errors.Join(err, fmt.Errorf("handler %s: %w", name, buildErr))
+				continue
+			}
+			mws, mwsErr := s.buildMiddlewares(handlerCr)
+			if mwsErr != nil {
+				err = errors.Join(err, fmt.Errorf("handler %s: %w", name, mwsErr))
+				continue
+			}
+			handlers[name] = handler
+			middlewares[name] = mws
 		}
 	}
 	if err != nil {
 		return err
 	}
 
-	for _, handler := range handlers {
-		gr := s.app.Group(handler.Path())
+	s.dump = config.Redact(cr.Map())
+	ops := s.app
+	if s.c.Admin.Enabled() {
+		s.admin = fiber.New(fiber.Config{DisableStartupMessage: true})
+		ops = s.admin
+		if s.c.Admin.Pprof {
+			s.admin.Use(pprof.New())
+		}
+		if s.c.Admin.ConfigDump {
+			s.admin.Get("/config", s.configDump)
+		}
+	}
+	if ops == s.app {
+		// fiberprometheus skips paths by the request path and swallows the
+		// handler error, so only skip routes that exist on the public app
+		s.prometheus.SetSkipPaths([]string{"/metrics", "/healthz", "/readyz"})
+	}
+	s.prometheus.RegisterAt(ops, "/metrics")
+	ops.Get("/healthz", s.healthz)
+	ops.Get("/readyz", s.readyz)
+
+	if s.c.Docs {
+		if err := s.addDocsRoutes(s.app, buildOpenAPI(handlers)); err != nil {
+			return err
+		}
+	}
+
+	if s.c.AccessLog {
+		s.app.Use(accessLog(s.logger))
+	}
+	for _, name := range slices.Sorted(maps.Keys(handlers)) {
+		handler := handlers[name]
+		chain := append([]fiber.Handler{handlerLogContext(name)}, middlewares[name]...)
+		gr := s.app.Group(handler.Path(), scoped(handler.Path(), chain)...)
 		handler.AddRoutes(gr)
 	}
+	s.handlers = handlers
 	return nil
 }
 
+// scoped limits group middlewares to the paths under prefix: fiber matches
+// group middlewares by a plain string prefix, so those of "/events" would
+// also run for "/events-test".
+func scoped(prefix string, handlers []fiber.Handler) []fiber.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	wrapped := make([]fiber.Handler, len(handlers))
+	for i, h := range handlers {
+		wrapped[i] = func(c *fiber.Ctx) error {
+			path, p := c.Path(), prefix
+			if !c.App().Config().CaseSensitive {
+				path, p = strings.ToLower(path), strings.ToLower(p)
+			}
+			if p == "" || path == p || strings.HasPrefix(path, p+"/") {
+				return h(c)
+			}
+			return c.Next()
+		}
+	}
+	return wrapped
+}
+
+// buildMiddlewares builds the handler's "middlewares" list in order; an
+// entry is either a registered middleware name or an object with a "name"
+// key and the middleware options.
+func (s *apiService) buildMiddlewares(cr config.IReader) ([]fiber.Handler, error) {
+	entries, err := config.GetList[any](cr, "middlewares")
+	if errors.Is(err, config.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	mws := make([]fiber.Handler, 0, len(entries))
+	for i, entry := range entries {
+		var (
+			name string
+			mwCr config.IReader = config.NewMapReader(map[string]any{})
+		)
+		switch v := entry.(type) {
+		case string:
+			name = v
+		case map[string]any:
+			mwCr = config.NewMapReader(v)
+			name, err = config.Get[string](mwCr, "name")
+			if err != nil {
+				return nil, fmt.Errorf("middleware %d: %w", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("middleware %d: %w: %v", i, config.ErrWrongType, entry)
+		}
+		mw, err := s.BuildMiddleware(name, mwCr)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %d %s: %w", i, name, err)
+		}
+		mws = append(mws, mw)
+	}
+	return mws, nil
+}
+
+var _ config.ISchemaProvider = (*apiService)(nil)
+
+func (s *apiService) Schema() *config.Schema {
+	schema := config.SchemaOf(NewConfig())
+	handlers := config.NewObjectSchema()
+	handlers.TypeKey = "type"
+	handlers.Types = make(map[string]*config.Schema)
+	s.handlersF.ForEach(func(name string, c handler.Constructor) bool {
+		h, err := c()
+		if err != nil {
+			s.logger.WithError(err).Warnf("handler %s schema unavailable", name)
+			return true
+		}
+		handlerSchema := config.NewObjectSchema()
+		if p, ok := h.(config.ISchemaProvider); ok {
+			handlerSchema = p.Schema()
+		}
+		handlerSchema.Properties["type"] = &config.Schema{Type: "string", Default: name}
+		handlerSchema.Properties["middlewares"] = &config.Schema{Type: "array"}
+		handlers.Properties[name] = handlerSchema
+		handlers.Types[name] = handlerSchema
+		return true
+	})
+	handlers.AdditionalProperties = &config.Schema{
+		Type: "object",
+		Properties: map[string]*config.Schema{
+			"type":        {Type: "string"},
+			"middlewares": {Type: "array"},
+		},
+	}
+	schema.Properties["handlers"] = handlers
+	return schema
+}
+
+var _ service.IReadyNotifier = (*apiService)(nil)
+
+func (s *apiService) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// startHandlers starts handlers in name order; if one fails, the ones already
+// started are stopped again.
+// startHandlers starts the handlers in name order and returns the names of
+// those started; on failure the started ones are stopped again.
+func (s *apiService) startHandlers() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.c.StartTimeout)
+	defer cancel()
+	started := []string{}
+	for _, name := range slices.Sorted(maps.Keys(s.handlers)) {
+		starter, ok := s.handlers[name].(handler.IStarter)
+		if !ok {
+			continue
+		}
+		if err := starter.Start(ctx); err != nil {
+			err = fmt.Errorf("start handler %s: %w", name, err)
+			return nil, errors.Join(err, s.unwindHandlers(ctx, started))
+		}
+		started = append(started, name)
+	}
+	return started, nil
+}
+
+// unwindHandlers stops the started handlers in reverse order.
+func (s *apiService) unwindHandlers(ctx context.Context, started []string) error {
+	var err error
+	for _, name := range slices.Backward(started) {
+		if stopper, ok := s.handlers[name].(handler.IStopper); ok {
+			err = errors.Join(err, stopper.Stop(ctx))
+		}
+	}
+	return err
+}
+
+func (s *apiService) configDump(c *fiber.Ctx) error {
+	return c.JSON(s.dump)
+}
+
+// Run serves the public app on every public listener and the admin app on
+// the admin listener, and returns once all of them are closed.
 func (s *apiService) Run() error {
-	return s.app.Listen(s.c.Addr)
+	started, err := s.startHandlers()
+	if err != nil {
+		return err
+	}
+
+	type served struct {
+		app *fiber.App
+		ln  net.Listener
+	}
+	var servers []served
+	for _, lc := range s.c.PublicListeners() {
+		ln, lnErr := listen(lc, s.logger)
+		if lnErr != nil {
+			err = errors.Join(err, fmt.Errorf("listen %s: %w", lc.Addr, lnErr))
+			break
+		}
+		servers = append(servers, served{app: s.app, ln: ln})
+	}
+	if err == nil && s.admin != nil {
+		ln, lnErr := listen(ListenerConfig{Addr: s.c.Admin.Addr}, s.logger)
+		if lnErr != nil {
+			err = fmt.Errorf("listen admin %s: %w", s.c.Admin.Addr, lnErr)
+		} else {
+			servers = append(servers, served{app: s.admin, ln: ln})
+		}
+	}
+	if err != nil {
+		for _, srv := range servers {
+			srv.ln.Close()
+		}
+		// the supervisor does not stop a failed unit, so the handlers
+		// started above are stopped here
+		ctx, cancel := context.WithTimeout(context.Background(), s.c.Drain.CloseTimeout)
+		defer cancel()
+		return errors.Join(err, s.unwindHandlers(ctx, started))
+	}
+
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		s.logger.Infof("listening on %s", srv.ln.Addr())
+		go func() {
+			errCh <- srv.app.Listener(srv.ln)
+		}()
+	}
+	for range servers {
+		if serveErr := <-errCh; serveErr != nil {
+			err = errors.Join(err, serveErr)
+			s.app.Shutdown()
+			if s.admin != nil {
+				s.admin.Shutdown()
+			}
+		}
+	}
+	return err
+}
+
+var _ service.IStopTimeoutProvider = (*apiService)(nil)
+
+// StopTimeout is the sum of the drain phases, so each phase gets its own
+// timeout within the supervisor's stop context.
+func (s *apiService) StopTimeout() time.Duration {
+	return s.c.Drain.PreStopDelay + s.c.Drain.ShutdownTimeout + s.c.Drain.FlushTimeout + s.c.Drain.CloseTimeout
 }
 
 func (s *apiService) Stop(ctx context.Context) error {
-	return s.app.ShutdownWithContext(ctx)
+	s.stopping.Store(true)
+	err := s.drain(ctx)
+	if s.admin != nil {
+		err = errors.Join(err, s.admin.ShutdownWithContext(ctx))
+	}
+	return err
 }
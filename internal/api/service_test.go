@@ -0,0 +1,347 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/handler"
+	"example.com/analytics_api/pkg/middleware"
+	"example.com/analytics_api/pkg/openapi"
+	"example.com/analytics_api/pkg/registry"
+	"example.com/analytics_api/pkg/service"
+	"github.com/ansrivas/fiberprometheus/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pingHandler struct{}
+
+func (h *pingHandler) Path() string {
+	return "/ping"
+}
+
+func (h *pingHandler) AddRoutes(rg fiber.Router) {
+	rg.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("pong")
+	})
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestService_Listeners(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	publicAddr, adminAddr := freeAddr(t), freeAddr(t)
+	s, err := NewService(
+		service.WithLogger(log.New()),
+		WithHandlerFactory("ping", func(...handler.Opt) (handler.IHandler, error) { return &pingHandler{}, nil }),
+		config.WithReader[service.IService](config.NewMapReader(map[string]any{
+			"api": map[string]any{
+				"listeners": []any{
+					map[string]any{"addr": publicAddr},
+					map[string]any{"addr": "unix:" + socket},
+				},
+				"admin": map[string]any{
+					"addr":        adminAddr,
+					"config_dump": true,
+				},
+				"handlers": map[string]any{
+					"ping": map[string]any{"storage": "clickhouse://user:secret@ch:9000/default"},
+				},
+			},
+		})),
+	)
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run() }()
+	select {
+	case <-s.(service.IReadyNotifier).Ready():
+	case <-time.After(time.Second):
+		t.Fatal("api service is not ready")
+	}
+
+	tcpClient := &http.Client{}
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	get := func(client *http.Client, url string) (int, string) {
+		var resp *http.Response
+		require.Eventually(t, func() bool {
+			resp, err = client.Get(url)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get(tcpClient, "http://"+publicAddr+"/ping/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "pong", body)
+	code, body = get(unixClient, "http://api/ping/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "pong", body)
+
+	code, _ = get(tcpClient, "http://"+publicAddr+"/metrics")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get(tcpClient, "http://"+publicAddr+"/readyz")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get(tcpClient, "http://"+adminAddr+"/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get(tcpClient, "http://"+adminAddr+"/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get(tcpClient, "http://"+adminAddr+"/debug/pprof/")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, body = get(tcpClient, "http://"+adminAddr+"/config")
+	assert.Equal(t, http.StatusOK, code)
+	dump := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(body), &dump))
+	assert.Equal(t, "clickhouse://user:xxxxx@ch:9000/default", dump["api"].(map[string]any)["handlers"].(map[string]any)["ping"].(map[string]any)["storage"])
+
+	require.NoError(t, s.Stop(context.Background()))
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("api service is not stopped")
+	}
+}
+
+type pathHandler struct {
+	path string
+}
+
+func newPathHandler(opts ...handler.Opt) (handler.IHandler, error) {
+	h := &pathHandler{}
+	for _, opt := range opts {
+		if err := opt(h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (h *pathHandler) Configure(cr config.IReader) error {
+	path, err := config.Get[string](cr, "path")
+	h.path = path
+	return err
+}
+
+func (h *pathHandler) Path() string {
+	return h.path
+}
+
+func (h *pathHandler) AddRoutes(rg fiber.Router) {
+	rg.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(h.path)
+	})
+}
+
+func newTestService() *apiService {
+	s := &apiService{
+		c:            NewConfig(),
+		logger:       log.New(),
+		prometheus:   fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test", "http", "", nil),
+		handlersF:    registry.NewRegistry[handler.Constructor](),
+		middlewaresF: registry.NewRegistry[middleware.Constructor](),
+	}
+	s.app = fiber.New(fiber.Config{ErrorHandler: s.errorHandler})
+	return s
+}
+
+func TestService_HandlerTypes(t *testing.T) {
+	s := newTestService()
+	require.NoError(t, s.Register("path", newPathHandler))
+	require.NoError(t, s.RegisterMiddleware("tag", tagMiddleware))
+	require.NoError(t, s.Configure(config.NewMapReader(map[string]any{
+		"api": map[string]any{
+			"handlers": map[string]any{
+				"prod":    map[string]any{"type": "path", "path": "/events", "middlewares": []any{"tag"}},
+				"sandbox": map[string]any{"type": "path", "path": "/events-test"},
+			},
+		},
+	})))
+	assert.Len(t, s.handlers, 2)
+
+	for path, tags := range map[string]string{"/events": "default", "/events-test": ""} {
+		resp, err := s.app.Test(httptest.NewRequest(fiber.MethodGet, path+"/", nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, path, string(body))
+		assert.Equal(t, tags, resp.Header.Get("X-Tags"), path)
+	}
+
+	err := newTestService().Configure(config.NewMapReader(map[string]any{
+		"api": map[string]any{
+			"handlers": map[string]any{
+				"prod": map[string]any{"type": "unknown"},
+			},
+		},
+	}))
+	assert.ErrorContains(t, err, "handler prod")
+}
+
+type lifecycleHandler struct {
+	pathHandler
+	startErr error
+	calls    *[]string
+	name     string
+}
+
+func (h *lifecycleHandler) Start(context.Context) error {
+	*h.calls = append(*h.calls, "start "+h.name)
+	return h.startErr
+}
+
+func (h *lifecycleHandler) Stop(context.Context) error {
+	*h.calls = append(*h.calls, "stop "+h.name)
+	return nil
+}
+
+func TestService_StartHandlers(t *testing.T) {
+	calls := []string{}
+	s := newTestService()
+	s.handlers = map[string]handler.IHandler{
+		"a": &lifecycleHandler{name: "a", calls: &calls},
+		"b": &lifecycleHandler{name: "b", calls: &calls},
+		"c": &lifecycleHandler{name: "c", calls: &calls, startErr: errors.New("clickhouse is down")},
+		"d": &pingHandler{},
+	}
+
+	err := s.Run()
+	assert.ErrorContains(t, err, "start handler c: clickhouse is down")
+	assert.Equal(t, []string{"start a", "start b", "start c", "stop b", "stop a"}, calls)
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.db")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0o644))
+	_, err := listen(ListenerConfig{Addr: "unix:" + file}, log.New())
+	assert.ErrorContains(t, err, "is not a socket")
+	data, _ := os.ReadFile(file)
+	assert.Equal(t, "data", string(data))
+
+	socket := filepath.Join(dir, "api.sock")
+	stale, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	ln, err := listen(ListenerConfig{Addr: "unix:" + socket}, log.New())
+	require.NoError(t, err)
+	ln.Close()
+}
+
+func TestService_ListenFailureStopsHandlers(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	calls := []string{}
+	s := newTestService()
+	s.c.Addr = busy.Addr().String()
+	s.handlers = map[string]handler.IHandler{
+		"a": &lifecycleHandler{name: "a", calls: &calls},
+		"b": &lifecycleHandler{name: "b", calls: &calls},
+	}
+
+	err = s.Run()
+	assert.ErrorContains(t, err, "listen "+busy.Addr().String())
+	assert.Equal(t, []string{"start a", "start b", "stop b", "stop a"}, calls)
+}
+
+type documentedHandler struct {
+	pathHandler
+}
+
+func (h *documentedHandler) Routes() []openapi.Route {
+	return []openapi.Route{{
+		Method: fiber.MethodGet,
+		Path:   "/",
+		Operation: &openapi.Operation{
+			OperationID: "get",
+			Responses:   map[string]*openapi.Response{"200": {Description: "path"}},
+		},
+	}}
+}
+
+func TestService_OpenAPI(t *testing.T) {
+	s := newTestService()
+	require.NoError(t, s.Register("documented", func(opts ...handler.Opt) (handler.IHandler, error) {
+		h := &documentedHandler{}
+		for _, opt := range opts {
+			if err := opt(h); err != nil {
+				return nil, err
+			}
+		}
+		return h, nil
+	}))
+	require.NoError(t, s.Configure(config.NewMapReader(map[string]any{
+		"api": map[string]any{
+			"handlers": map[string]any{
+				"documented": map[string]any{"path": "/doc"},
+			},
+		},
+	})))
+
+	resp, err := s.app.Test(httptest.NewRequest(fiber.MethodGet, "/openapi.json", nil))
+	require.NoError(t, err)
+	doc := openapi.Document{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+	if assert.Contains(t, doc.Paths, "/doc/") {
+		assert.Equal(t, "documented.get", (*doc.Paths["/doc/"])["get"].OperationID)
+	}
+
+	resp, err = s.app.Test(httptest.NewRequest(fiber.MethodGet, "/docs", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, fiber.MIMETextHTMLCharsetUTF8, resp.Header.Get(fiber.HeaderContentType))
+}
+
+type schemaHandler struct {
+	pathHandler
+}
+
+func (h *schemaHandler) Schema() *config.Schema {
+	s := config.NewObjectSchema()
+	s.Properties["path"] = &config.Schema{Type: "string", Default: "/default"}
+	return s
+}
+
+func TestService_Schema(t *testing.T) {
+	s := newTestService()
+	require.NoError(t, s.Register("schema", func(...handler.Opt) (handler.IHandler, error) { return &schemaHandler{}, nil }))
+
+	m := config.ApplyDefaults(s.Schema(), map[string]any{
+		"handlers": map[string]any{
+			"schema":  map[string]any{},
+			"sandbox": map[string]any{"type": "schema"},
+		},
+	})
+	assert.Equal(t, map[string]any{
+		"schema":  map[string]any{"type": "schema", "path": "/default"},
+		"sandbox": map[string]any{"type": "schema", "path": "/default"},
+	}, m["handlers"])
+}
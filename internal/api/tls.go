@@ -0,0 +1,171 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var tlsReloadInterval = 5 * time.Second
+
+type TLSConfig struct {
+	Cert     string `config:"cert"`
+	Key      string `config:"key"`
+	ClientCA string `config:"client_ca"`
+}
+
+func (c *TLSConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	for key, target := range map[string]*string{
+		"cert":      &newC.Cert,
+		"key":       &newC.Key,
+		"client_ca": &newC.ClientCA,
+	} {
+		v, vErr := config.Get[string](cr, key)
+		if vErr != nil && !errors.Is(vErr, config.ErrNotFound) {
+			err = errors.Join(err, vErr)
+		} else if vErr == nil {
+			*target = v
+		}
+	}
+
+	if err == nil && (newC.Cert == "") != (newC.Key == "") {
+		err = errors.New("tls requires both cert and key")
+	}
+	if err == nil && newC.ClientCA != "" && newC.Cert == "" {
+		err = errors.New("tls client_ca requires cert and key")
+	}
+	if err == nil {
+		for _, file := range []string{newC.Cert, newC.Key, newC.ClientCA} {
+			if file == "" {
+				continue
+			}
+			if _, statErr := os.Stat(file); statErr != nil {
+				err = errors.Join(err, statErr)
+			}
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+func (c *TLSConfig) Enabled() bool {
+	return c.Cert != ""
+}
+
+// certReloader serves the certificate, key and client CA from disk and
+// reloads them when any of the files changes. The files are checked at most
+// once per tlsReloadInterval, on a new handshake; a failed reload keeps the
+// previous configuration.
+type certReloader struct {
+	c       *TLSConfig
+	logger  *log.Logger
+	m       sync.Mutex
+	checked time.Time
+	modTime time.Time
+	config  *tls.Config
+}
+
+func newCertReloader(c *TLSConfig, logger *log.Logger) (*certReloader, error) {
+	r := &certReloader{
+		c:      c,
+		logger: logger,
+	}
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.modTime = modTime
+	r.checked = time.Now()
+	return r, nil
+}
+
+func (r *certReloader) filesModTime() (time.Time, error) {
+	var modTime time.Time
+	for _, file := range []string{r.c.Cert, r.c.Key, r.c.ClientCA} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.c.Cert, r.c.Key)
+	if err != nil {
+		return err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if r.c.ClientCA != "" {
+		pem, err := os.ReadFile(r.c.ClientCA)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.c.ClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	r.config = cfg
+	return nil
+}
+
+func (r *certReloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if time.Since(r.checked) < tlsReloadInterval {
+		return r.config, nil
+	}
+	r.checked = time.Now()
+	modTime, err := r.filesModTime()
+	if err != nil {
+		r.logger.WithError(err).Error("tls certificate check failed")
+		return r.config, nil
+	}
+	if !modTime.After(r.modTime) {
+		return r.config, nil
+	}
+	if err := r.load(); err != nil {
+		r.logger.WithError(err).Error("tls certificate reload failed, keeping previous certificate")
+		return r.config, nil
+	}
+	r.modTime = modTime
+	r.logger.Info("tls certificate reloaded")
+	return r.config, nil
+}
+
+func (r *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.GetConfigForClient,
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"analytics"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	if keyFile == "" {
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func TestService_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test ca", 1, nil)
+	server := newTestCert(t, "server", 2, ca)
+	client := newTestCert(t, "producer-1", 3, ca)
+
+	c := TLSConfig{
+		Cert:     filepath.Join(dir, "server.crt"),
+		Key:      filepath.Join(dir, "server.key"),
+		ClientCA: filepath.Join(dir, "ca.crt"),
+	}
+	ca.write(t, c.ClientCA, "")
+	server.write(t, c.Cert, c.Key)
+
+	reloader, err := newCertReloader(&c, log.New())
+	require.NoError(t, err)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", reloader.TLSConfig())
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(handler.ClientSubject(c))
+	})
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		httpClient := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+		return httpClient.Get("https://" + ln.Addr().String() + "/")
+	}
+
+	resp, err := get(client.tls())
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "CN=producer-1,O=analytics", string(body))
+	assert.Equal(t, big.NewInt(2), resp.TLS.PeerCertificates[0].SerialNumber)
+
+	_, err = get()
+	assert.Error(t, err, "client without certificate must be rejected")
+
+	tlsReloadInterval = 0
+	defer func() { tlsReloadInterval = 5 * time.Second }()
+	renewed := newTestCert(t, "server", 4, ca)
+	renewed.write(t, c.Cert, c.Key)
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(c.Cert, later, later))
+
+	resp, err = get(client.tls())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, big.NewInt(4), resp.TLS.PeerCertificates[0].SerialNumber)
+}
+
+func TestTLSConfig_Read(t *testing.T) {
+	c := TLSConfig{}
+	assert.Error(t, c.Read(config.NewMapReader(map[string]any{"cert": "server.crt"})))
+	assert.Error(t, c.Read(config.NewMapReader(map[string]any{"cert": "missing.crt", "key": "missing.key"})))
+	assert.Equal(t, TLSConfig{}, c)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "example.com/analytics_api/internal/api"
+
+type headerCarrier struct {
+	h *fasthttp.RequestHeader
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (c headerCarrier) Get(key string) string {
+	return string(c.h.Peek(key))
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c.h.Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := []string{}
+	c.h.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// traceRequest starts a server span for the request, continuing the trace
+// from W3C trace-context headers if the client sent them. The span context is
+// stored in the user context, so handlers should start child spans from
+// c.UserContext().
+func traceRequest(c *fiber.Ctx) error {
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{&c.Request().Header})
+	ctx, span := otel.Tracer(tracerName).Start(
+		ctx,
+		c.Method(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(c.Path()),
+			semconv.ClientAddress(c.IP()),
+		),
+	)
+	defer span.End()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+
+	route := c.Route().Path
+	span.SetName(c.Method() + " " + route)
+	status := responseStatus(c, err)
+	span.SetAttributes(
+		semconv.HTTPRoute(route),
+		semconv.HTTPResponseStatusCode(status),
+	)
+	if id, ok := c.Locals(requestIdKey).(string); ok {
+		span.SetAttributes(attribute.String("http.request.id", id))
+	}
+	if subject := handler.ClientSubject(c); subject != "" {
+		span.SetAttributes(attribute.String("tls.client.subject", subject))
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, utils.StatusMessage(status))
+	}
+	return err
+}
@@ -1,14 +1,17 @@
 package events
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"example.com/analytics_api/pkg/config"
 	"example.com/analytics_api/pkg/handler"
-	"github.com/go-playground/validator/v10"
+	"example.com/analytics_api/pkg/openapi"
 	"github.com/gofiber/fiber/v2"
-	"github.com/sirupsen/logrus"
+	fiberlog "github.com/gofiber/fiber/v2/log"
 )
 
 const (
@@ -16,14 +19,34 @@ const (
 )
 
 type ApiConfig struct {
-	Path    string
-	Storage string
+	Path                string             `config:"path"`
+	Storage             string             `config:"storage"`
+	Table               string             `config:"table"`
+	SourceColumn        bool               `config:"source_column"`
+	Strict              bool               `config:"strict"`
+	LegacyNames         bool               `config:"legacy_names"`
+	MaxBodySize         int                `config:"max_body_size"`
+	MaxDecompressedSize int                `config:"max_decompressed_size"`
+	MaxDepth            int                `config:"max_depth"`
+	Formats             []string           `config:"formats"`
+	Beacon              bool               `config:"beacon"`
+	Pixel               bool               `config:"pixel"`
+	BrowserKeys         []BrowserKeyConfig `config:"browser_keys"`
+	MetricEvents        []string           `config:"metric_events"`
+	MaxMetricEvents     int                `config:"max_metric_events"`
 }
 
 func NewApiConfig() *ApiConfig {
 	return &ApiConfig{
-		Path:    "/events",
-		Storage: "clickhouse://127.0.0.1:9000/default?sslmode=disable",
+		Path:                "/events",
+		Storage:             "clickhouse://127.0.0.1:9000/default?sslmode=disable",
+		Table:               "demo_events_buff",
+		LegacyNames:         true,
+		MaxBodySize:         64 * 1024,
+		MaxDecompressedSize: 1024 * 1024,
+		MaxDepth:            8,
+		Formats:             []string{FormatJSON, FormatXML, FormatForm, FormatMultipart},
+		MaxMetricEvents:     100,
 	}
 }
 
@@ -39,12 +62,91 @@ func (c *ApiConfig) Read(cr config.IReader) error {
 	}
 
 	storage, storageErr := config.Get[string](cr, "storage")
-	if storageErr != nil && !errors.Is(pathErr, config.ErrNotFound) {
+	if storageErr != nil && !errors.Is(storageErr, config.ErrNotFound) {
 		err = errors.Join(err, storageErr)
 	} else if storageErr == nil {
 		newC.Storage = storage
 	}
 
+	table, tableErr := config.Get[string](cr, "table")
+	if tableErr != nil && !errors.Is(tableErr, config.ErrNotFound) {
+		err = errors.Join(err, tableErr)
+	} else if tableErr == nil {
+		newC.Table = table
+	}
+
+	for key, target := range map[string]*bool{
+		"strict":        &newC.Strict,
+		"legacy_names":  &newC.LegacyNames,
+		"beacon":        &newC.Beacon,
+		"pixel":         &newC.Pixel,
+		"source_column": &newC.SourceColumn,
+	} {
+		v, vErr := config.Get[bool](cr, key)
+		if vErr != nil && !errors.Is(vErr, config.ErrNotFound) {
+			err = errors.Join(err, vErr)
+		} else if vErr == nil {
+			*target = v
+		}
+	}
+
+	for key, target := range map[string]*int{
+		"max_body_size":         &newC.MaxBodySize,
+		"max_decompressed_size": &newC.MaxDecompressedSize,
+		"max_depth":             &newC.MaxDepth,
+		"max_metric_events":     &newC.MaxMetricEvents,
+	} {
+		v, vErr := config.Get[int](cr, key)
+		if vErr != nil && !errors.Is(vErr, config.ErrNotFound) {
+			err = errors.Join(err, vErr)
+		} else if vErr == nil {
+			*target = v
+		}
+	}
+
+	formats, formatsErr := config.GetList[string](cr, "formats")
+	if formatsErr != nil && !errors.Is(formatsErr, config.ErrNotFound) {
+		err = errors.Join(err, formatsErr)
+	} else if formatsErr == nil {
+		newC.Formats = formats
+	}
+
+	metricEvents, metricEventsErr := config.GetList[string](cr, "metric_events")
+	if metricEventsErr != nil && !errors.Is(metricEventsErr, config.ErrNotFound) {
+		err = errors.Join(err, metricEventsErr)
+	} else if metricEventsErr == nil {
+		newC.MetricEvents = metricEvents
+	}
+
+	// a key without api_key fails with ErrNotFound too, so presence is
+	// checked first
+	if _, ok := cr.Get("browser_keys"); ok {
+		browserKeys, browserKeysErr := readBrowserKeys(cr, "browser_keys")
+		if browserKeysErr != nil {
+			err = errors.Join(err, browserKeysErr)
+		} else {
+			newC.BrowserKeys = browserKeys
+		}
+	}
+
+	for _, format := range newC.Formats {
+		if _, ok := formatMediaTypes[format]; !ok {
+			err = errors.Join(err, fmt.Errorf("unknown format %q", format))
+		}
+	}
+	if err == nil && newC.MaxBodySize <= 0 {
+		err = fmt.Errorf("max body size must be positive, got %d", newC.MaxBodySize)
+	}
+	if err == nil && newC.MaxDecompressedSize <= 0 {
+		err = fmt.Errorf("max decompressed size must be positive, got %d", newC.MaxDecompressedSize)
+	}
+	if err == nil && newC.MaxMetricEvents < 0 {
+		err = fmt.Errorf("max metric events must not be negative, got %d", newC.MaxMetricEvents)
+	}
+	if err == nil && newC.MaxDepth <= 0 {
+		err = fmt.Errorf("max depth must be positive, got %d", newC.MaxDepth)
+	}
+
 	if err != nil {
 		return err
 	}
@@ -54,8 +156,11 @@ func (c *ApiConfig) Read(cr config.IReader) error {
 }
 
 type apiHandler struct {
-	c    *ApiConfig
-	repo IRepository
+	c         *ApiConfig
+	repo      IRepository
+	validator *eventValidator
+	labels    *eventLabels
+	zstd      *zstdDecoders
 }
 
 func NewHandler(opts ...handler.Opt) (handler.IHandler, error) {
@@ -67,11 +172,16 @@ func NewHandler(opts ...handler.Opt) (handler.IHandler, error) {
 			return nil, err
 		}
 	}
-	repo, err := BuildRepo(h.c.Storage)
+	repo, err := BuildRepo(h.c.Storage, h.c.Table, h.c.SourceColumn)
 	if err != nil {
 		return nil, err
 	}
 	h.repo = repo
+	if h.validator, err = newEventValidator(); err != nil {
+		return nil, err
+	}
+	h.labels = newEventLabels(h.c.MetricEvents, h.c.MaxMetricEvents)
+	h.zstd = newZstdDecoders(h.c.MaxDecompressedSize)
 
 	return h, nil
 }
@@ -80,27 +190,193 @@ func (h *apiHandler) Configure(cr config.IReader) error {
 	return h.c.Read(cr)
 }
 
+var _ config.ISchemaProvider = (*apiHandler)(nil)
+
+func (h *apiHandler) Schema() *config.Schema {
+	return config.SchemaOf(NewApiConfig())
+}
+
 func (h *apiHandler) Path() string {
 	return h.c.Path
 }
 
 func (h *apiHandler) AddRoutes(rg fiber.Router) {
 	rg.Post("/", h.handler)
+	if h.c.Beacon {
+		rg.Options("/beacon", h.allowBrowser)
+		rg.Post("/beacon", h.allowBrowser, h.beacon)
+	}
+	if h.c.Pixel {
+		rg.Options("/pixel.gif", h.allowBrowser)
+		rg.Get("/pixel.gif", h.allowBrowser, h.pixel)
+	}
+}
+
+var _ handler.IHealthChecker = (*apiHandler)(nil)
+
+func (h *apiHandler) CheckHealth(ctx context.Context) error {
+	return h.repo.Ping(ctx)
+}
+
+var _ handler.IFlusher = (*apiHandler)(nil)
+
+func (h *apiHandler) Flush(ctx context.Context) error {
+	return h.repo.Flush(ctx)
+}
+
+var _ handler.IStarter = (*apiHandler)(nil)
+
+func (h *apiHandler) Start(ctx context.Context) error {
+	return h.repo.Ping(ctx)
+}
+
+var _ handler.IStopper = (*apiHandler)(nil)
+
+func (h *apiHandler) Stop(context.Context) error {
+	return h.repo.Close()
+}
+
+var _ handler.IDocumenter = (*apiHandler)(nil)
+
+func (h *apiHandler) Routes() []openapi.Route {
+	mediaTypes := make([]string, 0, len(h.c.Formats))
+	for _, format := range h.c.Formats {
+		mediaTypes = append(mediaTypes, formatMediaTypes[format][0])
+	}
+	routes := []openapi.Route{
+		{
+			Method: fiber.MethodPost,
+			Path:   "/",
+			Operation: &openapi.Operation{
+				OperationID: "postEvent",
+				Summary:     "Store an event",
+				Description: "protobuf bodies follow proto/events.proto; protobuf and msgpack bodies may hold a batch of events.",
+				RequestBody: &openapi.RequestBody{
+					Required: true,
+					Content:  openapi.JSONContent(openapi.SchemaOf(ApiEvent{}), mediaTypes...),
+				},
+				Responses: map[string]*openapi.Response{
+					"200": {Description: "Event is stored"},
+					"400": {
+						Description: "Request body can not be parsed, has unknown fields in strict mode or the event is invalid",
+						Content:     openapi.JSONContent(errorSchema),
+					},
+					"413": {
+						Description: "Request body is larger than max_body_size or max_decompressed_size once decompressed",
+						Content:     openapi.JSONContent(errorSchema),
+					},
+					"415": {
+						Description: "Content encoding is not supported",
+						Content:     openapi.JSONContent(errorSchema),
+					},
+					"422": {
+						Description: "Content type is not supported",
+						Content:     openapi.JSONContent(errorSchema),
+					},
+					"500": {
+						Description: "Event can not be stored",
+						Content:     openapi.JSONContent(errorSchema),
+					},
+				},
+			},
+		},
+	}
+	if h.c.Beacon || h.c.Pixel {
+		routes = append(routes, h.browserRoutes()...)
+	}
+	return routes
 }
 
 func (h *apiHandler) handler(ctx *fiber.Ctx) error {
-	e := new(ApiEvent)
-	if err := ctx.BodyParser(e); err != nil {
-		logrus.WithError(err).Error("request parse error")
+	return h.ingest(ctx, h.parse)
+}
+
+// ingest parses, validates and stores the events of a request; routes
+// differ only in how they parse.
+func (h *apiHandler) ingest(ctx *fiber.Ctx, parse func(*fiber.Ctx) ([]*ApiEvent, error)) error {
+	_, span := tracer.Start(ctx.UserContext(), "events.parse")
+	batch, err := parse(ctx)
+	endSpan(span, err)
+	if err != nil {
+		rejectedEvents.WithLabelValues("", rejectParse).Inc()
+		fiberlog.WithContext(ctx.Context()).Errorw("request parse error", "error", err)
+		return parseError(err)
+	}
+
+	_, span = tracer.Start(ctx.UserContext(), "events.validate")
+	err = h.validate(batch, ctx.AcceptsLanguages(h.validator.languages...))
+	endSpan(span, err)
+	if err != nil {
+		fiberlog.WithContext(ctx.Context()).Errorw("request validate error", "error", err)
 		return err
 	}
-	if err := validator.New().Struct(e); err != nil {
-		logrus.WithError(err).Error("request validate error")
-		return &fiber.Error{Code: http.StatusBadRequest, Message: err.Error()}
+
+	now := time.Now()
+	for _, e := range batch {
+		e.Source = handler.ClientSubject(ctx)
+		observeLag(e, now)
 	}
-	if err := h.repo.Insert(e); err != nil {
-		logrus.WithError(err).Error("request insert error")
-		return ctx.SendStatus(http.StatusInternalServerError)
+
+	insertCtx, span := tracer.Start(ctx.UserContext(), "events.insert")
+	err = h.repo.Insert(insertCtx, batch)
+	for _, e := range batch {
+		if err != nil {
+			rejectedEvents.WithLabelValues(h.labels.label(e.Event), rejectStorage).Inc()
+		} else {
+			acceptedEvents.WithLabelValues(h.labels.label(e.Event)).Inc()
+		}
+	}
+	endSpan(span, err)
+	if err != nil {
+		fiberlog.WithContext(ctx.Context()).Errorw("request insert error", "error", err)
+		return handler.NewError(http.StatusInternalServerError, handler.CodeStorageError, "event can not be stored", err)
 	}
 	return nil
 }
+
+// validate checks every event of the batch, so one response lists all
+// failures; fields of a batch are prefixed with the event index.
+func (h *apiHandler) validate(batch []*ApiEvent, accepted string) error {
+	var invalid *handler.Error
+	for i, e := range batch {
+		err := h.validator.Struct(e, accepted)
+		if err == nil {
+			continue
+		}
+		rejectedEvents.WithLabelValues(h.labels.label(e.Event), rejectValidation).Inc()
+		hErr := &handler.Error{}
+		if !errors.As(err, &hErr) {
+			return err
+		}
+		if len(batch) > 1 {
+			for j := range hErr.Fields {
+				hErr.Fields[j].Field = fmt.Sprintf("[%d].%s", i, hErr.Fields[j].Field)
+			}
+		}
+		if invalid == nil {
+			invalid = hErr
+		} else {
+			invalid.Fields = append(invalid.Fields, hErr.Fields...)
+		}
+	}
+	if invalid == nil {
+		return nil
+	}
+	return invalid
+}
+
+var errorSchema = openapi.SchemaOf(handler.ErrorResponse{})
+
+func parseError(err error) error {
+	var (
+		handlerErr *handler.Error
+		fiberErr   *fiber.Error
+	)
+	if errors.As(err, &handlerErr) {
+		return handlerErr
+	}
+	if errors.As(err, &fiberErr) {
+		return handler.NewError(fiberErr.Code, handler.CodeUnsupportedContentType, fiberErr.Message, err)
+	}
+	return handler.NewError(http.StatusBadRequest, handler.CodeInvalidBody, "request body can not be parsed", err)
+}
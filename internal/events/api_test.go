@@ -0,0 +1,476 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/handler"
+	"example.com/analytics_api/pkg/middleware"
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type fakeRepo struct {
+	events  []*ApiEvent
+	batches []int
+	err     error
+}
+
+func (r *fakeRepo) Insert(_ context.Context, events []*ApiEvent) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.events = append(r.events, events...)
+	r.batches = append(r.batches, len(events))
+	return nil
+}
+
+func (r *fakeRepo) Ping(context.Context) error {
+	return r.err
+}
+
+func (r *fakeRepo) Flush(context.Context) error {
+	return nil
+}
+
+func (r *fakeRepo) Close() error {
+	return nil
+}
+
+func newTestApp(t *testing.T, repo IRepository, opts ...handler.Opt) *fiber.App {
+	h, err := NewHandler(opts...)
+	require.NoError(t, err)
+	h.(*apiHandler).repo = &instrumentedRepo{repo: repo, storage: "fake"}
+	app := fiber.New(fiber.Config{ErrorHandler: testErrorHandler})
+	h.AddRoutes(app.Group(h.Path()))
+	return app
+}
+
+func testErrorHandler(c *fiber.Ctx, err error) error {
+	hErr := &handler.Error{}
+	if !errors.As(err, &hErr) {
+		return fiber.DefaultErrorHandler(c, err)
+	}
+	return c.Status(hErr.Status).JSON(hErr.Fields)
+}
+
+func postEvent(t *testing.T, app *fiber.App, body string) int {
+	return postEventAs(t, app, fiber.MIMEApplicationJSON, body).StatusCode
+}
+
+func postEventAs(t *testing.T, app *fiber.App, contentType, body string) *http.Response {
+	req := httptest.NewRequest(fiber.MethodPost, "/events/", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+// delta returns how much the metric changed since delta was called; the
+// metrics are global, so tests must not rely on their absolute values.
+func delta(c prometheus.Collector) func() float64 {
+	before := testutil.ToFloat64(c)
+	return func() float64 {
+		return testutil.ToFloat64(c) - before
+	}
+}
+
+func TestHandler_Metrics(t *testing.T) {
+	repo := &fakeRepo{}
+	app := newTestApp(t, repo)
+
+	accepted := delta(acceptedEvents.WithLabelValues("metrics_view"))
+	assert.Equal(t, fiber.StatusOK, postEvent(t, app, `{"dt":"2020-01-01T14:16:34Z","userid":"1","event":"metrics_view"}`))
+	assert.Len(t, repo.events, 1)
+	assert.Equal(t, 1.0, accepted())
+	assert.Equal(t, 1, testutil.CollectAndCount(batchSize))
+
+	invalid := delta(rejectedEvents.WithLabelValues("metrics_view", rejectValidation))
+	assert.Equal(t, fiber.StatusBadRequest, postEvent(t, app, `{"userid":"1","event":"metrics_view"}`))
+	assert.Equal(t, 1.0, invalid())
+
+	stored := delta(rejectedEvents.WithLabelValues("metrics_view", rejectStorage))
+	insertErrs := delta(insertErrors.WithLabelValues("fake"))
+	repo.err = errors.New("storage is down")
+	assert.Equal(t, fiber.StatusInternalServerError, postEvent(t, app, `{"dt":"2020-01-01T14:16:34Z","userid":"1","event":"metrics_view"}`))
+	assert.Equal(t, 1.0, stored())
+	assert.Equal(t, 1.0, insertErrs())
+	assert.Equal(t, 0.0, testutil.ToFloat64(pendingEvents.WithLabelValues("fake")))
+}
+
+func TestTableExpr(t *testing.T) {
+	db := ch.Connect()
+	defer db.Close()
+	for table, expected := range map[string]string{
+		"demo_events_buff":         `INSERT INTO "demo_events_buff" (`,
+		"sandbox.demo_events_buff": `INSERT INTO "sandbox"."demo_events_buff" (`,
+	} {
+		expr, args := tableExpr(table)
+		q, err := db.NewInsert().Model(new(ClickhouseEvent)).ModelTableExpr(expr, args...).AppendQuery(db.Formatter(), nil)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(q), expected), string(q))
+	}
+}
+
+func TestClickhouseRepo_SourceColumn(t *testing.T) {
+	db := ch.Connect()
+	defer db.Close()
+	for _, source := range []bool{false, true} {
+		repo := &clickhouseRepo{db: db, table: "demo_events_buff", source: source}
+		q, err := repo.insertQuery(&[]ClickhouseEvent{{Source: "CN=client"}}).AppendQuery(db.Formatter(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, source, strings.Contains(string(q), `"source"`), string(q))
+	}
+}
+
+func TestClickhouseRepo_Flush(t *testing.T) {
+	repo := &clickhouseRepo{}
+	assert.NoError(t, repo.Flush(context.Background()))
+
+	repo.begin()
+	repo.begin()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, repo.Flush(ctx), context.DeadlineExceeded)
+
+	done := make(chan error)
+	go func() { done <- repo.Flush(context.Background()) }()
+	repo.end()
+	repo.end()
+	assert.NoError(t, <-done)
+}
+
+func TestHandler_Routes(t *testing.T) {
+	h, err := NewHandler()
+	require.NoError(t, err)
+	routes := h.(handler.IDocumenter).Routes()
+	require.Len(t, routes, 1)
+	schema := routes[0].Operation.RequestBody.Content[fiber.MIMEApplicationJSON].Schema
+	assert.Equal(t, []string{"dt", "event", "user_id"}, schema.Required)
+	assert.NotContains(t, schema.Properties, "source")
+}
+
+func TestHandler_Errors(t *testing.T) {
+	app := newTestApp(t, &fakeRepo{})
+
+	resp := postEventAs(t, app, fiber.MIMEApplicationJSON, `{"userid":"1","event":"errors_view"`)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	resp = postEventAs(t, app, fiber.MIMETextPlain, `userid=1`)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+
+	req := httptest.NewRequest(fiber.MethodPost, "/events/", strings.NewReader(`{"userid":"1","event":"errors_view"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAcceptLanguage, "ru-RU,ru;q=0.9,en;q=0.8")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	fields := []handler.FieldError{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&fields))
+	assert.Equal(t, []handler.FieldError{{Field: "dt", Rule: "required", Message: "dt обязательное поле"}}, fields)
+}
+
+func TestHandler_Decode(t *testing.T) {
+	repo := &fakeRepo{}
+	app := newTestApp(t, repo)
+
+	for _, body := range []string{
+		`{"dt":"2020-01-01T14:16:34Z","user_id":"1","event":"decode_view","screen":"main"}`,
+		`{"DT":"2020-01-01T14:16:34Z","UserId":"1","event":"decode_view","screen":"main","unknown":1}`,
+		`{"dt":"2020-01-01T14:16:34Z","userid":"2","user_id":"1","event":"decode_view","screen":"main"}`,
+	} {
+		repo.events = nil
+		assert.Equal(t, fiber.StatusOK, postEvent(t, app, body), body)
+		if assert.Len(t, repo.events, 1, body) {
+			assert.Equal(t, "1", repo.events[0].UserId, body)
+			assert.Equal(t, "main", repo.events[0].Screen, body)
+		}
+	}
+
+	for contentType, body := range map[string]string{
+		fiber.MIMEApplicationForm:                       "dt=2020-01-01T14:16:34Z&userid=1&event=decode_view&screen=main",
+		fiber.MIMEApplicationXML:                        "<event><DT>2020-01-01T14:16:34Z</DT><userid>1</userid><event>decode_view</event><screen>main</screen><unknown>1</unknown></event>",
+		fiber.MIMEMultipartForm + "; boundary=boundary": "--boundary\r\nContent-Disposition: form-data; name=\"userid\"\r\n\r\n1\r\n--boundary\r\nContent-Disposition: form-data; name=\"dt\"\r\n\r\n2020-01-01T14:16:34Z\r\n--boundary\r\nContent-Disposition: form-data; name=\"event\"\r\n\r\ndecode_view\r\n--boundary\r\nContent-Disposition: form-data; name=\"screen\"\r\n\r\nmain\r\n--boundary--\r\n",
+	} {
+		repo.events = nil
+		assert.Equal(t, fiber.StatusOK, postEventAs(t, app, contentType, body).StatusCode, contentType)
+		if assert.Len(t, repo.events, 1, contentType) {
+			assert.Equal(t, "1", repo.events[0].UserId, contentType)
+			assert.Equal(t, "main", repo.events[0].Screen, contentType)
+		}
+	}
+}
+
+func withConfig(m map[string]any) handler.Opt {
+	return func(h handler.IHandler) error {
+		return h.(*apiHandler).Configure(config.NewMapReader(m))
+	}
+}
+
+func TestHandler_DecodeLimits(t *testing.T) {
+	h, err := NewHandler(withConfig(map[string]any{
+		"strict":        true,
+		"legacy_names":  false,
+		"max_body_size": 128,
+		"max_depth":     2,
+		"formats":       []any{"json", "form", "xml", "protobuf", "msgpack"},
+	}))
+	require.NoError(t, err)
+	ah := h.(*apiHandler)
+
+	parse := func(contentType, body string) error {
+		app := fiber.New()
+		var err error
+		app.Post("/", func(c *fiber.Ctx) error {
+			_, err = ah.parse(c)
+			return nil
+		})
+		req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, contentType)
+		_, testErr := app.Test(req)
+		require.NoError(t, testErr)
+		return err
+	}
+	status := func(err error) int {
+		hErr := &handler.Error{}
+		require.ErrorAs(t, err, &hErr)
+		return hErr.Status
+	}
+
+	assert.NoError(t, parse(fiber.MIMEApplicationJSON, `{"dt":"2020-01-01T14:16:34Z","user_id":"1","event":"view"}`))
+
+	err = parse(fiber.MIMEApplicationJSON, `{"dt":"2020-01-01T14:16:34Z","userid":"1","event":"view","extra":1}`)
+	hErr := &handler.Error{}
+	require.ErrorAs(t, err, &hErr)
+	assert.Equal(t, handler.CodeUnknownFields, hErr.Code)
+	assert.Equal(t, []string{"extra", "userid"}, []string{hErr.Fields[0].Field, hErr.Fields[1].Field})
+
+	err = parse(fiber.MIMEApplicationForm, "user_id=1&USERID=2")
+	require.ErrorAs(t, err, &hErr)
+	assert.Equal(t, handler.CodeUnknownFields, hErr.Code)
+
+	assert.NoError(t, parse(fiber.MIMEApplicationXML, `<event><dt>2020-01-01T14:16:34Z</dt><user_id>1</user_id><event>view</event></event>`))
+	err = parse(fiber.MIMEApplicationXML, `<event><user_id>1</user_id><UserId>2</UserId></event>`)
+	require.ErrorAs(t, err, &hErr)
+	assert.Equal(t, handler.CodeUnknownFields, hErr.Code)
+	assert.Equal(t, fiber.StatusBadRequest, status(parse(fiber.MIMEApplicationXML, `<event><screen><a>1</a></screen></event>`)))
+
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, status(parse(fiber.MIMEApplicationJSON, `{"event":"`+strings.Repeat("x", 128)+`"}`)))
+	assert.Equal(t, fiber.StatusBadRequest, status(parse(fiber.MIMEApplicationJSON, `{"event":[[1]]}`)))
+	assert.NoError(t, checkDepth([]byte(`{"event":[1]}`), 2))
+
+	nested, err := msgpack.Marshal(map[string]any{"event": []any{[]any{1}}})
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, status(parse("application/msgpack", string(nested))))
+	assert.NoError(t, checkMsgpackDepth(nested, 3))
+
+	empty, err := msgpack.Marshal([]any{})
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, status(parse("application/msgpack", string(empty))))
+	assert.Equal(t, fiber.StatusBadRequest, status(parse("application/x-protobuf; messageType="+protoEventBatch, "")))
+
+	// a truncated value is a parse error, not an unknown field
+	truncated := protowire.AppendTag(nil, 2, protowire.BytesType)
+	truncated = protowire.AppendVarint(truncated, 10)
+	err = parse("application/x-protobuf", string(truncated))
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &hErr) && hErr.Code == handler.CodeUnknownFields, err.Error())
+}
+
+func protoEventBody(dt time.Time, event, userId string, amount int64) []byte {
+	var ts []byte
+	ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(dt.Unix()))
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, ts)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, event)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, userId)
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(amount))
+	return b
+}
+
+func TestHandler_Formats(t *testing.T) {
+	repo := &fakeRepo{}
+	dt := time.Date(2020, 1, 1, 14, 16, 34, 0, time.UTC)
+	single := protoEventBody(dt, "formats_view", "1", 100)
+	var batch []byte
+	for _, userId := range []string{"1", "2"} {
+		batch = protowire.AppendTag(batch, 1, protowire.BytesType)
+		batch = protowire.AppendBytes(batch, protoEventBody(dt, "formats_view", userId, 0))
+	}
+	msgpackBatch, err := msgpack.Marshal([]map[string]any{
+		{"dt": dt, "event": "formats_view", "userid": "1", "amount": 100},
+		{"dt": dt, "event": "formats_view", "user_id": "2"},
+	})
+	require.NoError(t, err)
+
+	app := newTestApp(t, repo)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, postEventAs(t, app, "application/x-protobuf", string(single)).StatusCode)
+
+	app = newTestApp(t, repo, withConfig(map[string]any{"formats": []any{"protobuf", "msgpack"}}))
+	for _, tc := range []struct {
+		contentType string
+		body        []byte
+		count       int
+		amount      int
+	}{
+		{"application/x-protobuf", single, 1, 100},
+		{"application/x-protobuf; messageType=" + protoEventBatch, batch, 2, 0},
+		{"application/msgpack", msgpackBatch, 2, 100},
+	} {
+		repo.events, repo.batches = nil, nil
+		assert.Equal(t, fiber.StatusOK, postEventAs(t, app, tc.contentType, string(tc.body)).StatusCode, tc.contentType)
+		assert.Equal(t, []int{tc.count}, repo.batches, tc.contentType)
+		if assert.Len(t, repo.events, tc.count, tc.contentType) {
+			assert.Equal(t, dt, repo.events[0].Dt.UTC(), tc.contentType)
+			assert.Equal(t, "1", repo.events[0].UserId, tc.contentType)
+			assert.Equal(t, tc.amount, repo.events[0].Amount, tc.contentType)
+		}
+	}
+
+	assert.Equal(t, fiber.StatusUnprocessableEntity, postEvent(t, app, `{"dt":"2020-01-01T14:16:34Z","user_id":"1","event":"formats_view"}`))
+	assert.Equal(t, fiber.StatusBadRequest, postEventAs(t, app, "application/x-protobuf", "\xff").StatusCode)
+
+	invalid, err := msgpack.Marshal([]map[string]any{
+		{"dt": dt, "event": "formats_view", "user_id": "1"},
+		{"dt": dt, "event": "formats_view"},
+	})
+	require.NoError(t, err)
+	resp := postEventAs(t, app, "application/msgpack", string(invalid))
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	fields := []handler.FieldError{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&fields))
+	assert.Equal(t, []handler.FieldError{{Field: "[1].user_id", Rule: "required", Message: "user_id is a required field"}}, fields)
+
+	repo.events, repo.err = nil, errors.New("storage is down")
+	assert.Equal(t, fiber.StatusInternalServerError, postEventAs(t, app, "application/msgpack", string(msgpackBatch)).StatusCode)
+	assert.Empty(t, repo.events)
+}
+
+func compressBody(t *testing.T, encoding string, body []byte) []byte {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	case "br":
+		w = brotli.NewWriter(buf)
+	case "zstd":
+		var err error
+		w, err = zstd.NewWriter(buf)
+		require.NoError(t, err)
+	}
+	_, err := w.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestHandler_Decompress(t *testing.T) {
+	repo := &fakeRepo{}
+	app := newTestApp(t, repo, withConfig(map[string]any{"max_decompressed_size": 1024}))
+	post := func(encoding string, body []byte) int {
+		req := httptest.NewRequest(fiber.MethodPost, "/events/", bytes.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderContentEncoding, encoding)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	event := []byte(`{"dt":"2020-01-01T14:16:34Z","user_id":"1","event":"decompress_view","screen":"` + strings.Repeat("main", 50) + `"}`)
+	for _, encoding := range []string{"gzip", "deflate", "br", "zstd"} {
+		repo.events = nil
+		assert.Equal(t, fiber.StatusOK, post(encoding, compressBody(t, encoding, event)), encoding)
+		assert.Len(t, repo.events, 1, encoding)
+	}
+	assert.Equal(t, 4, testutil.CollectAndCount(compressionRatio))
+
+	bomb := compressBody(t, "gzip", bytes.Repeat([]byte(" "), 1024*1024))
+	assert.Less(t, len(bomb), 2048)
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, post("gzip", bomb))
+	zstdBomb := compressBody(t, "zstd", bytes.Repeat([]byte(" "), 1024*1024))
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, post("zstd", zstdBomb))
+	repo.events = nil
+	assert.Equal(t, fiber.StatusOK, post("zstd", compressBody(t, "zstd", event)))
+	assert.Len(t, repo.events, 1)
+	assert.Equal(t, fiber.StatusUnsupportedMediaType, post("compress", event))
+	assert.Equal(t, fiber.StatusBadRequest, post("gzip", event))
+}
+
+func TestHandler_DecompressBodyLimit(t *testing.T) {
+	h, err := NewHandler(withConfig(map[string]any{"max_decompressed_size": 64 * 1024}))
+	require.NoError(t, err)
+	h.(*apiHandler).repo = &instrumentedRepo{repo: &fakeRepo{}, storage: "fake"}
+	limit, err := middleware.NewBodyLimit(config.NewMapReader(map[string]any{"limit": 2048}))
+	require.NoError(t, err)
+	app := fiber.New(fiber.Config{ErrorHandler: testErrorHandler})
+	h.AddRoutes(app.Group(h.Path(), limit))
+	post := func(body []byte) (int, string) {
+		req := httptest.NewRequest(fiber.MethodPost, "/events/", bytes.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderContentEncoding, "gzip")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// the limit applies to the compressed body
+	event := []byte(`{"dt":"2020-01-01T14:16:34Z","user_id":"1","event":"limit_view","screen":"` + strings.Repeat("main", 1024) + `"}`)
+	code, _ := post(compressBody(t, "gzip", event))
+	assert.Equal(t, fiber.StatusOK, code)
+
+	// a bomb passes the middleware and is stopped by the capped decompression
+	code, body := post(compressBody(t, "gzip", bytes.Repeat([]byte(" "), 1024*1024)))
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, code)
+	assert.NotEqual(t, fiber.ErrRequestEntityTooLarge.Message, body, "rejected by the middleware")
+}
+
+func TestEventLabels(t *testing.T) {
+	l := newEventLabels(nil, 2)
+	assert.Equal(t, "view", l.label("view"))
+	assert.Equal(t, "click", l.label("click"))
+	assert.Equal(t, otherEvent, l.label("random_1"))
+	assert.Equal(t, "view", l.label("view"))
+
+	l = newEventLabels([]string{"pay"}, 2)
+	assert.Equal(t, "pay", l.label("pay"))
+	assert.Equal(t, otherEvent, l.label("view"))
+
+	repo := &fakeRepo{}
+	app := newTestApp(t, repo, withConfig(map[string]any{"metric_events": []any{"labels_view"}}))
+	view := delta(acceptedEvents.WithLabelValues("labels_view"))
+	unknown := delta(acceptedEvents.WithLabelValues("labels_unknown"))
+	other := delta(acceptedEvents.WithLabelValues(otherEvent))
+	assert.Equal(t, fiber.StatusOK, postEvent(t, app, `{"dt":"2020-01-01T14:16:34Z","user_id":"1","event":"labels_view"}`))
+	assert.Equal(t, fiber.StatusOK, postEvent(t, app, `{"dt":"2020-01-01T14:16:34Z","user_id":"1","event":"labels_unknown"}`))
+	assert.Equal(t, 1.0, view())
+	assert.Equal(t, 0.0, unknown())
+	assert.Equal(t, 1.0, other())
+}
@@ -0,0 +1,245 @@
+package events
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/handler"
+	"example.com/analytics_api/pkg/openapi"
+	"github.com/gofiber/fiber/v2"
+)
+
+// BrowserKeyConfig is an API key for browser pages, which can not send
+// headers with beacons and pixels, so the key comes in the api_key query
+// parameter and is only accepted from the listed origins; "*" allows any.
+type BrowserKeyConfig struct {
+	ApiKey  string   `config:"api_key"`
+	Origins []string `config:"origins"`
+}
+
+func (c *BrowserKeyConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	apiKey, apiKeyErr := config.Get[string](cr, "api_key")
+	if apiKeyErr != nil {
+		err = errors.Join(err, apiKeyErr)
+	} else {
+		newC.ApiKey = apiKey
+	}
+
+	origins, originsErr := config.GetList[string](cr, "origins")
+	if originsErr != nil {
+		err = errors.Join(err, originsErr)
+	} else {
+		newC.Origins = origins
+	}
+
+	if err == nil && newC.ApiKey == "" {
+		err = errors.New("api key must not be empty")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+func (c *BrowserKeyConfig) allows(origin string) bool {
+	return slices.Contains(c.Origins, "*") || (origin != "" && slices.Contains(c.Origins, origin))
+}
+
+func readBrowserKeys(cr config.IReader, key string) ([]BrowserKeyConfig, error) {
+	rawKeys, err := config.GetList[map[string]any](cr, key)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]BrowserKeyConfig, len(rawKeys))
+	for i, rawKey := range rawKeys {
+		if keyErr := keys[i].Read(config.NewMapReader(rawKey)); keyErr != nil {
+			err = errors.Join(err, fmt.Errorf("browser key %d: %w", i, keyErr))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// pixelGIF is a transparent 1x1 GIF.
+var pixelGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// browserQueryParams are query parameters of beacons and pixels that are not
+// event fields: the API key and the usual cache buster.
+var browserQueryParams = []string{"api_key", "_"}
+
+// allowBrowser checks the browser key and origin of beacons and pixels and
+// answers CORS preflights. Pixels carry no Origin, so the Referer is used.
+func (h *apiHandler) allowBrowser(ctx *fiber.Ctx) error {
+	origin := ctx.Get(fiber.HeaderOrigin)
+	if origin == "" {
+		if referer, err := url.Parse(ctx.Get(fiber.HeaderReferer)); err == nil && referer.Host != "" {
+			origin = referer.Scheme + "://" + referer.Host
+		}
+	}
+
+	// beacons and pixels need no credentials, so the origin is echoed only
+	// when it is listed explicitly and "*" is sent otherwise
+	allowOrigin := "*"
+	if len(h.c.BrowserKeys) > 0 {
+		key := h.browserKey(ctx.Query("api_key"))
+		if key == nil {
+			return handler.NewError(http.StatusUnauthorized, handler.CodeOf(http.StatusUnauthorized), "api key is missing or invalid", nil)
+		}
+		if !key.allows(origin) {
+			return handler.NewError(http.StatusForbidden, handler.CodeOf(http.StatusForbidden), fmt.Sprintf("origin %q is not allowed", origin), nil)
+		}
+		if origin != "" && slices.Contains(key.Origins, origin) {
+			allowOrigin = origin
+		}
+	}
+
+	if allowOrigin != "*" {
+		ctx.Vary(fiber.HeaderOrigin)
+	}
+	ctx.Set(fiber.HeaderAccessControlAllowOrigin, allowOrigin)
+	if ctx.Method() == fiber.MethodOptions {
+		ctx.Set(fiber.HeaderAccessControlAllowMethods, strings.Join([]string{fiber.MethodGet, fiber.MethodPost}, ", "))
+		ctx.Set(fiber.HeaderAccessControlAllowHeaders, fiber.HeaderContentType)
+		ctx.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(int(time.Hour.Seconds())))
+		return ctx.SendStatus(http.StatusNoContent)
+	}
+	return ctx.Next()
+}
+
+func (h *apiHandler) browserKey(apiKey string) *BrowserKeyConfig {
+	if apiKey == "" {
+		return nil
+	}
+	for i := range h.c.BrowserKeys {
+		if subtle.ConstantTimeCompare([]byte(h.c.BrowserKeys[i].ApiKey), []byte(apiKey)) == 1 {
+			return &h.c.BrowserKeys[i]
+		}
+	}
+	return nil
+}
+
+// beacon accepts navigator.sendBeacon posts, whose string bodies are sent as
+// text/plain, by reading the body as JSON whatever the content type.
+func (h *apiHandler) beacon(ctx *fiber.Ctx) error {
+	err := h.ingest(ctx, func(ctx *fiber.Ctx) ([]*ApiEvent, error) {
+		if _, err := h.decompress(ctx); err != nil {
+			return nil, err
+		}
+		body := ctx.BodyRaw()
+		if len(body) > h.c.MaxBodySize {
+			return nil, bodyTooLarge("request body is larger than %d bytes", h.c.MaxBodySize)
+		}
+		e := new(ApiEvent)
+		return []*ApiEvent{e}, h.parseJSON(body, e)
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+// pixel reads the event from the query string and answers with a GIF.
+func (h *apiHandler) pixel(ctx *fiber.Ctx) error {
+	err := h.ingest(ctx, func(ctx *fiber.Ctx) ([]*ApiEvent, error) {
+		args := ctx.Request().URI().QueryArgs()
+		values := make(map[string][]string)
+		args.VisitAll(func(key, value []byte) {
+			if !slices.Contains(browserQueryParams, string(key)) {
+				values[string(key)] = append(values[string(key)], string(value))
+			}
+		})
+		renamed, err := renameFields(h, values)
+		if err != nil {
+			return nil, err
+		}
+		args.Reset()
+		for key, vs := range renamed {
+			for _, v := range vs {
+				args.Add(key, v)
+			}
+		}
+		e := new(ApiEvent)
+		return []*ApiEvent{e}, ctx.QueryParser(e)
+	})
+	if err != nil {
+		return err
+	}
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	ctx.Type("gif")
+	return ctx.Send(pixelGIF)
+}
+
+func (h *apiHandler) browserRoutes() []openapi.Route {
+	var params []*openapi.Parameter
+	if len(h.c.BrowserKeys) > 0 {
+		params = append(params, &openapi.Parameter{
+			Name:     "api_key",
+			In:       "query",
+			Required: true,
+			Schema:   &openapi.Schema{Type: "string"},
+		})
+	}
+	responses := func(ok string, content map[string]*openapi.MediaType) map[string]*openapi.Response {
+		return map[string]*openapi.Response{
+			ok:    {Description: "Event is stored", Content: content},
+			"400": {Description: "Event can not be parsed or is invalid", Content: openapi.JSONContent(errorSchema)},
+			"401": {Description: "API key is missing or invalid", Content: openapi.JSONContent(errorSchema)},
+			"403": {Description: "Origin is not allowed for the API key", Content: openapi.JSONContent(errorSchema)},
+			"500": {Description: "Event can not be stored", Content: openapi.JSONContent(errorSchema)},
+		}
+	}
+
+	schema := openapi.SchemaOf(ApiEvent{})
+	var routes []openapi.Route
+	if h.c.Beacon {
+		routes = append(routes, openapi.Route{
+			Method: fiber.MethodPost,
+			Path:   "/beacon",
+			Operation: &openapi.Operation{
+				OperationID: "postBeacon",
+				Summary:     "Store an event sent with navigator.sendBeacon",
+				Parameters:  params,
+				RequestBody: &openapi.RequestBody{
+					Required: true,
+					Content:  openapi.JSONContent(schema, fiber.MIMETextPlain, fiber.MIMEApplicationJSON),
+				},
+				Responses: responses("204", nil),
+			},
+		})
+	}
+	if h.c.Pixel {
+		routes = append(routes, openapi.Route{
+			Method: fiber.MethodGet,
+			Path:   "/pixel.gif",
+			Operation: &openapi.Operation{
+				OperationID: "getPixel",
+				Summary:     "Store an event passed in the query string of a tracking pixel",
+				Parameters:  slices.Concat(params, openapi.QueryParameters(schema)),
+				Responses: responses("200", map[string]*openapi.MediaType{
+					"image/gif": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+				}),
+			},
+		})
+	}
+	return routes
+}
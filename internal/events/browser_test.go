@@ -0,0 +1,100 @@
+package events
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_Browser(t *testing.T) {
+	repo := &fakeRepo{}
+	app := newTestApp(t, repo, withConfig(map[string]any{
+		"beacon": true,
+		"pixel":  true,
+		"browser_keys": []any{
+			map[string]any{"api_key": "site", "origins": []any{"https://example.com"}},
+			map[string]any{"api_key": "any", "origins": []any{"*"}},
+		},
+	}))
+	send := func(method, target string, headers map[string]string, body string) (int, map[string][]string) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header
+	}
+	beacon := `{"dt":"2020-01-01T14:16:34Z","user_id":"1","event":"beacon_view"}`
+	origin := map[string]string{fiber.HeaderOrigin: "https://example.com", fiber.HeaderContentType: "text/plain;charset=UTF-8"}
+
+	code, header := send(fiber.MethodPost, "/events/beacon?api_key=site", origin, beacon)
+	assert.Equal(t, fiber.StatusNoContent, code)
+	assert.Equal(t, "https://example.com", header[fiber.HeaderAccessControlAllowOrigin][0])
+	assert.Empty(t, header[fiber.HeaderAccessControlAllowCredentials])
+	require.Len(t, repo.events, 1)
+	assert.Equal(t, "beacon_view", repo.events[0].Event)
+
+	code, _ = send(fiber.MethodPost, "/events/beacon", origin, beacon)
+	assert.Equal(t, fiber.StatusUnauthorized, code)
+	code, _ = send(fiber.MethodPost, "/events/beacon?api_key=site", map[string]string{fiber.HeaderOrigin: "https://evil.com"}, beacon)
+	assert.Equal(t, fiber.StatusForbidden, code)
+	code, header = send(fiber.MethodPost, "/events/beacon?api_key=any", map[string]string{fiber.HeaderOrigin: "https://evil.com"}, beacon)
+	assert.Equal(t, fiber.StatusNoContent, code)
+	assert.Equal(t, "*", header[fiber.HeaderAccessControlAllowOrigin][0])
+
+	code, header = send(fiber.MethodOptions, "/events/beacon?api_key=site", origin, "")
+	assert.Equal(t, fiber.StatusNoContent, code)
+	assert.Contains(t, header[fiber.HeaderAccessControlAllowMethods][0], fiber.MethodPost)
+	assert.Len(t, repo.events, 2)
+
+	repo.events = nil
+	code, header = send(
+		fiber.MethodGet, "/events/pixel.gif?api_key=site&_=123&dt=2020-01-01T14:16:34Z&userid=1&event=pixel_view&amount=5",
+		map[string]string{fiber.HeaderReferer: "https://example.com/pricing"}, "",
+	)
+	assert.Equal(t, fiber.StatusOK, code)
+	assert.Equal(t, "image/gif", header[fiber.HeaderContentType][0])
+	assert.Equal(t, "no-store", header[fiber.HeaderCacheControl][0])
+	require.Len(t, repo.events, 1)
+	assert.Equal(t, "1", repo.events[0].UserId)
+	assert.Equal(t, 5, repo.events[0].Amount)
+
+	code, _ = send(fiber.MethodGet, "/events/pixel.gif?api_key=site&event=pixel_view", nil, "")
+	assert.Equal(t, fiber.StatusForbidden, code)
+	code, _ = send(fiber.MethodGet, "/events/pixel.gif?api_key=any&event=pixel_view", nil, "")
+	assert.Equal(t, fiber.StatusBadRequest, code)
+}
+
+func TestHandler_BrowserDisabled(t *testing.T) {
+	app := newTestApp(t, &fakeRepo{})
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/events/pixel.gif?event=view", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	app = newTestApp(t, &fakeRepo{}, withConfig(map[string]any{"beacon": true}))
+	req := httptest.NewRequest(fiber.MethodOptions, "/events/beacon", nil)
+	req.Header.Set(fiber.HeaderOrigin, "https://evil.com")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, "*", resp.Header.Get(fiber.HeaderAccessControlAllowOrigin))
+	assert.Empty(t, resp.Header.Get(fiber.HeaderAccessControlAllowCredentials))
+
+	h, err := NewHandler()
+	require.NoError(t, err)
+	assert.Len(t, h.(handler.IDocumenter).Routes(), 1)
+
+	h, err = NewHandler(withConfig(map[string]any{"pixel": true, "browser_keys": []any{map[string]any{"api_key": "k", "origins": []any{"*"}}}}))
+	require.NoError(t, err)
+	routes := h.(handler.IDocumenter).Routes()
+	require.Len(t, routes, 2)
+	assert.Equal(t, "api_key", routes[1].Operation.Parameters[0].Name)
+
+	_, err = NewHandler(withConfig(map[string]any{"browser_keys": []any{map[string]any{"origins": []any{"*"}}}}))
+	assert.ErrorContains(t, err, "browser key 0")
+}
@@ -0,0 +1,293 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/gofiber/fiber/v2"
+)
+
+// eventFields are the field names of ApiEvent in request bodies.
+var eventFields = func() map[string]struct{} {
+	fields := make(map[string]struct{})
+	t := reflect.TypeOf(ApiEvent{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := fieldName(t.Field(i)); name != "" {
+			fields[name] = struct{}{}
+		}
+	}
+	return fields
+}()
+
+// legacyFieldNames are lowercased names accepted before the fields had
+// explicit tags, mapped onto the current names.
+var legacyFieldNames = map[string]string{
+	"userid": "user_id",
+}
+
+// fieldKey returns the ApiEvent field name for a key of a request body.
+func (h *apiHandler) fieldKey(key string) (string, bool) {
+	if _, ok := eventFields[key]; ok {
+		return key, true
+	}
+	if !h.c.LegacyNames {
+		return "", false
+	}
+	lower := strings.ToLower(key)
+	if _, ok := eventFields[lower]; ok {
+		return lower, true
+	}
+	name, ok := legacyFieldNames[lower]
+	return name, ok
+}
+
+// renameFields renames the keys of a request body to field names; a key
+// spelled exactly as the field wins over its aliases. Unknown keys are
+// dropped, or rejected in strict mode.
+func renameFields[V any](h *apiHandler, values map[string]V) (map[string]V, error) {
+	renamed := make(map[string]V, len(values))
+	var unknown []string
+	for key, v := range values {
+		name, ok := h.fieldKey(key)
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		if _, dup := renamed[name]; dup && key != name {
+			continue
+		}
+		renamed[name] = v
+	}
+	if len(unknown) > 0 && h.c.Strict {
+		slices.Sort(unknown)
+		err := handler.NewError(http.StatusBadRequest, handler.CodeUnknownFields, "request body has unknown fields", nil)
+		for _, key := range unknown {
+			err.Fields = append(err.Fields, handler.FieldError{Field: key, Rule: "unknown", Message: key + " is not a known field"})
+		}
+		return nil, err
+	}
+	return renamed, nil
+}
+
+// Request body formats, enabled per handler with the formats key.
+const (
+	FormatJSON      = "json"
+	FormatXML       = "xml"
+	FormatForm      = "form"
+	FormatMultipart = "multipart"
+	FormatProtobuf  = "protobuf"
+	FormatMsgpack   = "msgpack"
+)
+
+// formatMediaTypes are the media types of each format; the first one is
+// the one documented.
+var formatMediaTypes = map[string][]string{
+	FormatJSON:      {fiber.MIMEApplicationJSON},
+	FormatXML:       {fiber.MIMEApplicationXML, fiber.MIMETextXML},
+	FormatForm:      {fiber.MIMEApplicationForm},
+	FormatMultipart: {fiber.MIMEMultipartForm},
+	FormatProtobuf:  {"application/x-protobuf", "application/protobuf"},
+	FormatMsgpack:   {"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+}
+
+func formatOf(mediaType string) string {
+	for format, mediaTypes := range formatMediaTypes {
+		if slices.Contains(mediaTypes, mediaType) {
+			return format
+		}
+	}
+	return ""
+}
+
+// parse decodes the request body into events after applying the encoding,
+// format, size, depth and field name rules of the handler; protobuf and
+// msgpack bodies may hold a batch.
+func (h *apiHandler) parse(ctx *fiber.Ctx) ([]*ApiEvent, error) {
+	compressed, err := h.decompress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body := ctx.BodyRaw()
+	if !compressed && len(body) > h.c.MaxBodySize {
+		return nil, bodyTooLarge("request body is larger than %d bytes", h.c.MaxBodySize)
+	}
+
+	ctype := string(ctx.Request().Header.ContentType())
+	mediaType, params, _ := mime.ParseMediaType(ctype)
+	format := formatOf(mediaType)
+	if format == "" || !slices.Contains(h.c.Formats, format) {
+		return nil, handler.NewError(
+			http.StatusUnprocessableEntity, handler.CodeUnsupportedContentType,
+			fmt.Sprintf("content type %q is not supported", ctype), nil,
+		)
+	}
+
+	switch format {
+	case FormatJSON:
+		e := new(ApiEvent)
+		return []*ApiEvent{e}, h.parseJSON(body, e)
+	case FormatXML:
+		e := new(ApiEvent)
+		return []*ApiEvent{e}, h.parseXML(body, e)
+	case FormatProtobuf:
+		return requireEvents(h.parseProtobuf(body, params["messagetype"]))
+	case FormatMsgpack:
+		return requireEvents(h.parseMsgpack(body))
+	case FormatForm:
+		args := ctx.Request().PostArgs()
+		values := make(map[string][]string)
+		args.VisitAll(func(key, value []byte) {
+			values[string(key)] = append(values[string(key)], string(value))
+		})
+		renamed, err := renameFields(h, values)
+		if err != nil {
+			return nil, err
+		}
+		args.Reset()
+		for key, vs := range renamed {
+			for _, v := range vs {
+				args.Add(key, v)
+			}
+		}
+	case FormatMultipart:
+		form, err := ctx.MultipartForm()
+		if err != nil {
+			return nil, err
+		}
+		if form.Value, err = renameFields(h, form.Value); err != nil {
+			return nil, err
+		}
+	}
+	e := new(ApiEvent)
+	return []*ApiEvent{e}, ctx.BodyParser(e)
+}
+
+// requireEvents rejects a batch without events, which would otherwise be
+// accepted without storing anything.
+func requireEvents(batch []*ApiEvent, err error) ([]*ApiEvent, error) {
+	if err == nil && len(batch) == 0 {
+		return nil, handler.NewError(http.StatusBadRequest, handler.CodeInvalidBody, "request body has no events", nil)
+	}
+	return batch, err
+}
+
+func (h *apiHandler) parseJSON(body []byte, e *ApiEvent) error {
+	if err := checkDepth(body, h.c.MaxDepth); err != nil {
+		return err
+	}
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &values); err != nil {
+		return err
+	}
+	renamed, err := renameFields(h, values)
+	if err != nil {
+		return err
+	}
+	body, err = json.Marshal(renamed)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, e)
+}
+
+// parseXML reads the child elements of the root as fields, so XML bodies
+// follow the same field name and depth rules as JSON.
+func (h *apiHandler) parseXML(body []byte, e *ApiEvent) error {
+	values, err := xmlFields(body, h.c.MaxDepth)
+	if err != nil {
+		return err
+	}
+	renamed, err := renameFields(h, values)
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBufferString("<event>")
+	for key, v := range renamed {
+		buf.WriteString("<" + key + ">")
+		if err := xml.EscapeText(buf, []byte(v)); err != nil {
+			return err
+		}
+		buf.WriteString("</" + key + ">")
+	}
+	buf.WriteString("</event>")
+	return xml.Unmarshal(buf.Bytes(), e)
+}
+
+// xmlFields returns the text of each child element of the root element,
+// failing when elements are nested deeper than maxDepth.
+func xmlFields(body []byte, maxDepth int) (map[string]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	values := make(map[string]string)
+	depth := 0
+	var field string
+	var text bytes.Buffer
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth++; depth > maxDepth {
+				return nil, tooDeep(maxDepth)
+			}
+			if depth == 2 {
+				field = t.Name.Local
+				text.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				values[field] = text.String()
+			}
+			depth--
+		}
+	}
+}
+
+// checkDepth fails when objects and arrays of the JSON document are nested
+// deeper than maxDepth, before anything is decoded.
+func checkDepth(body []byte, maxDepth int) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if depth++; depth > maxDepth {
+				return tooDeep(maxDepth)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+func tooDeep(maxDepth int) error {
+	return handler.NewError(
+		http.StatusBadRequest, handler.CodeInvalidBody,
+		fmt.Sprintf("request body is nested deeper than %d levels", maxDepth), nil,
+	)
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decompressors open a reader for each supported Content-Encoding.
+var decompressors = map[string]func(*apiHandler, io.Reader) (io.ReadCloser, error){
+	"gzip": func(_ *apiHandler, r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": func(_ *apiHandler, r io.Reader) (io.ReadCloser, error) {
+		return zlib.NewReader(r)
+	},
+	"br": func(_ *apiHandler, r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	"zstd": func(h *apiHandler, r io.Reader) (io.ReadCloser, error) {
+		return h.zstd.open(r)
+	},
+}
+
+// zstdDecoders reuses zstd decoders between requests: each one allocates its
+// window buffers up front, so creating one per request is expensive. The
+// window and the decoded size are capped by max_decompressed_size, otherwise
+// a small frame could make the decoder allocate up to its default limits.
+type zstdDecoders struct {
+	pool sync.Pool
+	opts []zstd.DOption
+}
+
+func newZstdDecoders(maxSize int) *zstdDecoders {
+	return &zstdDecoders{opts: []zstd.DOption{
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxWindow(uint64(max(maxSize, zstd.MinWindowSize))),
+		zstd.WithDecoderMaxMemory(uint64(max(maxSize, 1))),
+	}}
+}
+
+func (p *zstdDecoders) open(r io.Reader) (io.ReadCloser, error) {
+	if d, ok := p.pool.Get().(*zstd.Decoder); ok {
+		if err := d.Reset(r); err != nil {
+			d.Close()
+			return nil, err
+		}
+		return &zstdReader{Decoder: d, pool: p}, nil
+	}
+	d, err := zstd.NewReader(r, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReader{Decoder: d, pool: p}, nil
+}
+
+// zstdReader returns the decoder to the pool on Close instead of releasing it.
+type zstdReader struct {
+	*zstd.Decoder
+	pool *zstdDecoders
+}
+
+func (r *zstdReader) Close() error {
+	if err := r.Decoder.Reset(nil); err != nil {
+		r.Decoder.Close()
+		return nil
+	}
+	r.pool.pool.Put(r.Decoder)
+	return nil
+}
+
+// decompress replaces a compressed request body with the decoded one, so the
+// parsers never see Content-Encoding; fiber would otherwise decode it without
+// any size limit. It reports whether the body was compressed.
+func (h *apiHandler) decompress(ctx *fiber.Ctx) (bool, error) {
+	encoding := strings.ToLower(strings.TrimSpace(string(ctx.Request().Header.Peek(fiber.HeaderContentEncoding))))
+	if encoding == "" || encoding == "identity" {
+		return false, nil
+	}
+	open, ok := decompressors[encoding]
+	if !ok {
+		return false, handler.NewError(
+			http.StatusUnsupportedMediaType, handler.CodeUnsupportedContentEncoding,
+			fmt.Sprintf("content encoding %q is not supported", encoding), nil,
+		)
+	}
+
+	raw := ctx.BodyRaw()
+	if len(raw) > h.c.MaxBodySize {
+		return false, bodyTooLarge("request body is larger than %d bytes", h.c.MaxBodySize)
+	}
+	r, err := open(h, bytes.NewReader(raw))
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	body, err := io.ReadAll(io.LimitReader(r, int64(h.c.MaxDecompressedSize)+1))
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return false, bodyTooLarge("decompressed request body is larger than %d bytes", h.c.MaxDecompressedSize)
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(body) > h.c.MaxDecompressedSize {
+		return false, bodyTooLarge("decompressed request body is larger than %d bytes", h.c.MaxDecompressedSize)
+	}
+
+	if len(raw) > 0 {
+		compressionRatio.WithLabelValues(encoding).Observe(float64(len(body)) / float64(len(raw)))
+	}
+	ctx.Request().SetBodyRaw(body)
+	ctx.Request().Header.Del(fiber.HeaderContentEncoding)
+	return true, nil
+}
+
+func bodyTooLarge(format string, limit int) error {
+	return handler.NewError(
+		http.StatusRequestEntityTooLarge, handler.CodeOf(http.StatusRequestEntityTooLarge),
+		fmt.Sprintf(format, limit), nil,
+	)
+}
@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	metricsNamespace = "analytics"
+	metricsSubsystem = "events"
+)
+
+const (
+	rejectParse      = "parse"
+	rejectValidation = "validation"
+	rejectStorage    = "storage"
+)
+
+var (
+	acceptedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "accepted_total",
+		Help:      "Events stored, by event name.",
+	}, []string{"event"})
+	rejectedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "rejected_total",
+		Help:      "Events rejected, by event name and reason.",
+	}, []string{"event", "reason"})
+	eventLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "lag_seconds",
+		Help:      "Difference between receive time and event time.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600},
+	})
+	insertDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "insert_duration_seconds",
+		Help:      "Storage insert latency, by storage backend.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"storage"})
+	insertErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "insert_errors_total",
+		Help:      "Failed storage inserts, by storage backend.",
+	}, []string{"storage"})
+	batchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "batch_size",
+		Help:      "Events written per storage insert, by storage backend.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"storage"})
+	compressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "compression_ratio",
+		Help:      "Decompressed to compressed request body size, by content encoding.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"encoding"})
+	pendingEvents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "pending",
+		Help:      "Events accepted but not yet written, by storage backend.",
+	}, []string{"storage"})
+)
+
+// otherEvent is the event label of events over the label limit.
+const otherEvent = "other"
+
+// eventLabels bounds the values of the event label, which come from
+// clients: only configured names are used, or without a list the first
+// limit distinct names; everything else is counted as "other".
+type eventLabels struct {
+	allowed map[string]struct{}
+	limit   int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newEventLabels(allowed []string, limit int) *eventLabels {
+	l := &eventLabels{limit: limit, seen: make(map[string]struct{})}
+	if len(allowed) > 0 {
+		l.allowed = make(map[string]struct{}, len(allowed))
+		for _, event := range allowed {
+			l.allowed[event] = struct{}{}
+		}
+	}
+	return l
+}
+
+func (l *eventLabels) label(event string) string {
+	if l.allowed != nil {
+		if _, ok := l.allowed[event]; ok {
+			return event
+		}
+		return otherEvent
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[event]; ok {
+		return event
+	}
+	if len(l.seen) >= l.limit {
+		return otherEvent
+	}
+	l.seen[event] = struct{}{}
+	return event
+}
+
+func observeLag(e *ApiEvent, now time.Time) {
+	eventLag.Observe(max(now.Sub(e.Dt).Seconds(), 0))
+}
+
+// instrumentedRepo records storage metrics around the wrapped repository.
+type instrumentedRepo struct {
+	repo    IRepository
+	storage string
+}
+
+func (r *instrumentedRepo) Insert(ctx context.Context, events []*ApiEvent) error {
+	pending := pendingEvents.WithLabelValues(r.storage)
+	pending.Add(float64(len(events)))
+	defer pending.Sub(float64(len(events)))
+
+	start := time.Now()
+	err := r.repo.Insert(ctx, events)
+	insertDuration.WithLabelValues(r.storage).Observe(time.Since(start).Seconds())
+	batchSize.WithLabelValues(r.storage).Observe(float64(len(events)))
+	if err != nil {
+		insertErrors.WithLabelValues(r.storage).Inc()
+	}
+	return err
+}
+
+func (r *instrumentedRepo) Ping(ctx context.Context) error {
+	return r.repo.Ping(ctx)
+}
+
+func (r *instrumentedRepo) Flush(ctx context.Context) error {
+	return r.repo.Flush(ctx)
+}
+
+func (r *instrumentedRepo) Close() error {
+	return r.repo.Close()
+}
@@ -7,12 +7,13 @@ import (
 )
 
 type ApiEvent struct {
-	Dt     time.Time `validate:"required"`
-	Event  string    `validate:"required"`
-	UserId string    `validate:"required"`
-	Screen string
-	Elem   string
-	Amount int
+	Dt     time.Time `json:"dt" form:"dt" query:"dt" xml:"dt" validate:"required"`
+	Event  string    `json:"event" form:"event" query:"event" xml:"event" validate:"required"`
+	UserId string    `json:"user_id" form:"user_id" query:"user_id" xml:"user_id" validate:"required"`
+	Screen string    `json:"screen,omitempty" form:"screen" query:"screen" xml:"screen"`
+	Elem   string    `json:"elem,omitempty" form:"elem" query:"elem" xml:"elem"`
+	Amount int       `json:"amount,omitempty" form:"amount" query:"amount" xml:"amount"`
+	Source string    `json:"-" form:"-" query:"-" xml:"-"`
 }
 
 type ClickhouseEvent struct {
@@ -24,6 +25,7 @@ type ClickhouseEvent struct {
 	Screen string    `ch:"screen,  type:String"`
 	Elem   string    `ch:"elem,    type:String"`
 	Amount int       `ch:"amount,  type:Int64"`
+	Source string    `ch:"source,  type:LowCardinality(String)"`
 }
 
 func (e *ClickhouseEvent) Unmarshal(event *ApiEvent) error {
@@ -33,5 +35,6 @@ func (e *ClickhouseEvent) Unmarshal(event *ApiEvent) error {
 	e.Screen = event.Screen
 	e.Elem = event.Elem
 	e.Amount = event.Amount
+	e.Source = event.Source
 	return nil
 }
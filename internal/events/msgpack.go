@@ -0,0 +1,117 @@
+package events
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// parseMsgpack decodes a map as a single event or an array of maps as a
+// batch; field names follow the json tags, including legacy names.
+func (h *apiHandler) parseMsgpack(body []byte) ([]*ApiEvent, error) {
+	if err := checkMsgpackDepth(body, h.c.MaxDepth); err != nil {
+		return nil, err
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(body))
+	code, err := dec.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+	if !msgpcode.IsFixedArray(code) && code != msgpcode.Array16 && code != msgpcode.Array32 {
+		e, err := h.decodeMsgpackEvent(dec)
+		if err != nil {
+			return nil, err
+		}
+		return []*ApiEvent{e}, checkMsgpackEOF(dec)
+	}
+
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+	batch := make([]*ApiEvent, 0, min(n, len(body)))
+	for i := 0; i < n; i++ {
+		e, err := h.decodeMsgpackEvent(dec)
+		if err != nil {
+			return nil, fmt.Errorf("events[%d]: %w", i, err)
+		}
+		batch = append(batch, e)
+	}
+	return batch, checkMsgpackEOF(dec)
+}
+
+func (h *apiHandler) decodeMsgpackEvent(dec *msgpack.Decoder) (*ApiEvent, error) {
+	values := make(map[string]msgpack.RawMessage)
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+	renamed, err := renameFields(h, values)
+	if err != nil {
+		return nil, err
+	}
+	b, err := msgpack.Marshal(renamed)
+	if err != nil {
+		return nil, err
+	}
+	eventDec := msgpack.NewDecoder(bytes.NewReader(b))
+	eventDec.SetCustomStructTag("json")
+	e := new(ApiEvent)
+	return e, eventDec.Decode(e)
+}
+
+func checkMsgpackEOF(dec *msgpack.Decoder) error {
+	if _, err := dec.PeekCode(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after the end of the message")
+	}
+	return nil
+}
+
+// checkMsgpackDepth fails when maps and arrays are nested deeper than
+// maxDepth, counted the same way as for JSON, before anything is decoded.
+func checkMsgpackDepth(body []byte, maxDepth int) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(body))
+	for {
+		if _, err := dec.PeekCode(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := skipMsgpack(dec, 1, maxDepth); err != nil {
+			return err
+		}
+	}
+}
+
+func skipMsgpack(dec *msgpack.Decoder, depth, maxDepth int) error {
+	code, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	var n int
+	switch {
+	case msgpcode.IsFixedMap(code) || code == msgpcode.Map16 || code == msgpcode.Map32:
+		if n, err = dec.DecodeMapLen(); err != nil {
+			return err
+		}
+		n *= 2
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		if n, err = dec.DecodeArrayLen(); err != nil {
+			return err
+		}
+	default:
+		return dec.Skip()
+	}
+	if depth > maxDepth {
+		return tooDeep(maxDepth)
+	}
+	for range n {
+		if err := skipMsgpack(dec, depth+1, maxDepth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package events
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"example.com/analytics_api/pkg/handler"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Message types of proto/events.proto, selected by the messageType parameter
+// of the content type.
+const (
+	protoEvent      = "analytics.events.v1.Event"
+	protoEventBatch = "analytics.events.v1.EventBatch"
+)
+
+func (h *apiHandler) parseProtobuf(body []byte, messageType string) ([]*ApiEvent, error) {
+	switch messageType {
+	case "", protoEvent:
+		e, err := h.decodeProtoEvent(body)
+		if err != nil {
+			return nil, err
+		}
+		return []*ApiEvent{e}, nil
+	case protoEventBatch:
+		var batch []*ApiEvent
+		err := h.consumeProtoFields(body, func(num protowire.Number, typ protowire.Type, b []byte) (int, bool, error) {
+			if num != 1 || typ != protowire.BytesType {
+				return 0, false, nil
+			}
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, true, nil
+			}
+			e, err := h.decodeProtoEvent(v)
+			if err != nil {
+				return 0, true, fmt.Errorf("events[%d]: %w", len(batch), err)
+			}
+			batch = append(batch, e)
+			return n, true, nil
+		})
+		return batch, err
+	}
+	return nil, handler.NewError(
+		http.StatusUnprocessableEntity, handler.CodeUnsupportedContentType,
+		fmt.Sprintf("protobuf message type %q is not supported", messageType), nil,
+	)
+}
+
+func (h *apiHandler) decodeProtoEvent(body []byte) (*ApiEvent, error) {
+	e := new(ApiEvent)
+	err := h.consumeProtoFields(body, func(num protowire.Number, typ protowire.Type, b []byte) (int, bool, error) {
+		if num == 6 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			e.Amount = int(int64(v))
+			return n, true, nil
+		}
+		if num < 1 || num > 5 || typ != protowire.BytesType {
+			return 0, false, nil
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, true, nil
+		}
+		switch num {
+		case 1:
+			dt, err := decodeProtoTimestamp(v)
+			if err != nil {
+				return 0, true, err
+			}
+			e.Dt = dt
+		case 2:
+			e.Event = string(v)
+		case 3:
+			e.UserId = string(v)
+		case 4:
+			e.Screen = string(v)
+		case 5:
+			e.Elem = string(v)
+		}
+		return n, true, nil
+	})
+	return e, err
+}
+
+func decodeProtoTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if (num == 1 || num == 2) && typ == protowire.VarintType {
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			if num == 1 {
+				seconds = int64(v)
+			} else {
+				nanos = int64(int32(v))
+			}
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
+
+// consumeProtoFields calls field for every field of the message; field
+// returns how many bytes of the value it consumed, or a negative protowire
+// error code, and whether it knows the field. Unknown fields are skipped or
+// rejected in strict mode.
+func (h *apiHandler) consumeProtoFields(b []byte, field func(protowire.Number, protowire.Type, []byte) (int, bool, error)) error {
+	var unknown []handler.FieldError
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, known, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if !known {
+			unknown = append(unknown, handler.FieldError{
+				Field:   fmt.Sprint(num),
+				Rule:    "unknown",
+				Message: fmt.Sprintf("field %d of wire type %d is not known", num, typ),
+			})
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	if len(unknown) > 0 && h.c.Strict {
+		err := handler.NewError(http.StatusBadRequest, handler.CodeUnknownFields, "request body has unknown fields", nil)
+		err.Fields = unknown
+		return err
+	}
+	return nil
+}
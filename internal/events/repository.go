@@ -4,44 +4,142 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"strings"
+	"sync"
 
+	"example.com/analytics_api/pkg/tracing"
 	"github.com/uptrace/go-clickhouse/ch"
 )
 
 type IRepository interface {
-	Insert(*ApiEvent) error
+	// Insert stores the events in one write, so a batch is stored or
+	// rejected as a whole.
+	Insert(context.Context, []*ApiEvent) error
+	Ping(context.Context) error
+	Flush(context.Context) error
+	Close() error
 }
 
-func BuildRepo(addr string) (IRepository, error) {
+func BuildRepo(addr string, table string, sourceColumn bool) (IRepository, error) {
 	u, err := url.Parse(addr)
 	if err != nil {
 		return nil, err
 	}
 	switch u.Scheme {
 	case "ch", "clickhouse":
-		return NewClickhouse(addr)
+		repo, err := NewClickhouse(addr, table, sourceColumn)
+		if err != nil {
+			return nil, err
+		}
+		return &instrumentedRepo{repo: repo, storage: "clickhouse"}, nil
 	}
 	return nil, fmt.Errorf("unknown evens repository type %s", u.Scheme)
 }
 
 type clickhouseRepo struct {
-	db *ch.DB
+	db    *ch.DB
+	table string
+	// source is written only when enabled, tables created before the
+	// column was added have no such column
+	source bool
+
+	m        sync.Mutex
+	inflight int
+	idle     chan struct{}
 }
 
-func NewClickhouse(addr string) (IRepository, error) {
+func NewClickhouse(addr string, table string, sourceColumn bool) (IRepository, error) {
+	db := ch.Connect(
+		ch.WithDSN(addr),
+		ch.WithMaxRetries(3),
+	)
+	db.AddQueryHook(tracing.NewQueryHook())
 	return &clickhouseRepo{
-		db: ch.Connect(
-			ch.WithDSN(addr),
-			ch.WithMaxRetries(3),
-		),
+		db:     db,
+		table:  table,
+		source: sourceColumn,
 	}, nil
 }
 
-func (c *clickhouseRepo) Insert(e *ApiEvent) error {
-	chE := new(ClickhouseEvent)
-	if err := chE.Unmarshal(e); err != nil {
+func (c *clickhouseRepo) Insert(ctx context.Context, events []*ApiEvent) error {
+	c.begin()
+	defer c.end()
+	chEvents := make([]ClickhouseEvent, len(events))
+	_, span := tracer.Start(ctx, "events.enrich")
+	var err error
+	for i, e := range events {
+		if err = chEvents[i].Unmarshal(e); err != nil {
+			break
+		}
+	}
+	endSpan(span, err)
+	if err != nil {
 		return err
 	}
-	_, err := c.db.NewInsert().Model(chE).Exec(context.TODO())
+	_, err = c.insertQuery(&chEvents).Exec(ctx)
 	return err
 }
+
+func (c *clickhouseRepo) insertQuery(model any) *ch.InsertQuery {
+	expr, args := tableExpr(c.table)
+	q := c.db.NewInsert().Model(model).ModelTableExpr(expr, args...)
+	if !c.source {
+		q = q.ExcludeColumn("source")
+	}
+	return q
+}
+
+func (c *clickhouseRepo) Ping(ctx context.Context) error {
+	return c.db.Ping(ctx)
+}
+
+// begin and end track inserts in flight, so Flush can wait for them.
+func (c *clickhouseRepo) begin() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.inflight == 0 {
+		c.idle = make(chan struct{})
+	}
+	c.inflight++
+}
+
+func (c *clickhouseRepo) end() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.inflight--
+	if c.inflight == 0 {
+		close(c.idle)
+	}
+}
+
+// Flush waits for the inserts in flight; events are not buffered in the
+// process, the buffer table flushes them on the ClickHouse side.
+func (c *clickhouseRepo) Flush(ctx context.Context) error {
+	c.m.Lock()
+	if c.inflight == 0 {
+		c.m.Unlock()
+		return nil
+	}
+	idle := c.idle
+	c.m.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *clickhouseRepo) Close() error {
+	return c.db.Close()
+}
+
+// tableExpr quotes a "table" or "database.table" name.
+func tableExpr(table string) (string, []any) {
+	parts := strings.Split(table, ".")
+	args := make([]any, len(parts))
+	for i, part := range parts {
+		args[i] = ch.Ident(part)
+	}
+	return strings.TrimSuffix(strings.Repeat("?.", len(parts)), "."), args
+}
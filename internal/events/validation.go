@@ -0,0 +1,98 @@
+package events
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	ru_translations "github.com/go-playground/validator/v10/translations/ru"
+)
+
+// eventValidator validates events and reports failures under the field names
+// clients send, with messages in the first supported language the client
+// accepts; English is the fallback.
+type eventValidator struct {
+	validate  *validator.Validate
+	uni       *ut.UniversalTranslator
+	languages []string
+}
+
+func newEventValidator() (*eventValidator, error) {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterTagNameFunc(fieldName)
+
+	fallback := en.New()
+	uni := ut.New(fallback, fallback, ru.New())
+	v := &eventValidator{validate: validate, uni: uni}
+	for _, lang := range []struct {
+		locale   locales.Translator
+		register func(*validator.Validate, ut.Translator) error
+	}{
+		{fallback, en_translations.RegisterDefaultTranslations},
+		{ru.New(), ru_translations.RegisterDefaultTranslations},
+	} {
+		trans, _ := uni.GetTranslator(lang.locale.Locale())
+		if err := lang.register(validate, trans); err != nil {
+			return nil, err
+		}
+		v.languages = append(v.languages, lang.locale.Locale())
+	}
+	return v, nil
+}
+
+// fieldName is the name of the field in request bodies: the json tag, then
+// the form tag, then the lowercased Go name, the same as in the OpenAPI
+// schema.
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return strings.ToLower(f.Name)
+}
+
+// Struct validates e and returns a handler error listing every failed field,
+// translated for the first of the accepted languages that is supported.
+func (v *eventValidator) Struct(e any, accepted ...string) error {
+	err := v.validate.Struct(e)
+	if err == nil {
+		return nil
+	}
+	hErr := handler.NewError(http.StatusBadRequest, handler.CodeValidationFailed, "event is invalid", err)
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return hErr
+	}
+	trans, _ := v.uni.FindTranslator(accepted...)
+	for _, fe := range fieldErrs {
+		hErr.Fields = append(hErr.Fields, handler.FieldError{
+			Field:   fieldPath(fe.Namespace()),
+			Rule:    fe.Tag(),
+			Message: fe.Translate(trans),
+		})
+	}
+	return hErr
+}
+
+// fieldPath drops the struct name from the namespace, so nested fields are
+// reported as "parent.child".
+func fieldPath(namespace string) string {
+	_, path, found := strings.Cut(namespace, ".")
+	if !found {
+		return namespace
+	}
+	return path
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"example.com/analytics_api/pkg/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventValidator(t *testing.T) {
+	v, err := newEventValidator()
+	require.NoError(t, err)
+
+	assert.NoError(t, v.Struct(&ApiEvent{Dt: time.Now(), Event: "view", UserId: "1"}))
+
+	err = v.Struct(&ApiEvent{Event: "view"})
+	hErr := &handler.Error{}
+	require.ErrorAs(t, err, &hErr)
+	assert.Equal(t, []handler.FieldError{
+		{Field: "dt", Rule: "required", Message: "dt is a required field"},
+		{Field: "user_id", Rule: "required", Message: "user_id is a required field"},
+	}, hErr.Fields)
+
+	err = v.Struct(&ApiEvent{Event: "view"}, "ru")
+	require.ErrorAs(t, err, &hErr)
+	assert.Equal(t, "user_id", hErr.Fields[1].Field)
+	assert.Equal(t, "user_id обязательное поле", hErr.Fields[1].Message)
+}
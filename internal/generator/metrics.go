@@ -0,0 +1,13 @@
+package generator
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var sloViolated = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "analytics",
+	Subsystem: "generator",
+	Name:      "slo_violated",
+	Help:      "1 if the last generator run violated its SLO, 0 if it passed.",
+})
@@ -0,0 +1,191 @@
+package generator
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/analytics_api/internal/events"
+	"example.com/analytics_api/pkg/config"
+)
+
+var replayTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+type ReplayConfig struct {
+	File       string  `config:"file"`
+	Speed      float64 `config:"speed"`
+	ShiftToNow bool    `config:"shift_to_now"`
+	UserPrefix string  `config:"user_prefix"`
+}
+
+func NewReplayConfig() *ReplayConfig {
+	return &ReplayConfig{
+		Speed: 1,
+	}
+}
+
+func (c *ReplayConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	file, fileErr := config.Get[string](cr, "file")
+	if fileErr != nil && !errors.Is(fileErr, config.ErrNotFound) {
+		err = errors.Join(err, fileErr)
+	} else if fileErr == nil {
+		newC.File = file
+	}
+
+	speed, speedErr := getFloat(cr, "speed")
+	if speedErr != nil && !errors.Is(speedErr, config.ErrNotFound) {
+		err = errors.Join(err, speedErr)
+	} else if speedErr == nil {
+		newC.Speed = speed
+	}
+
+	shiftToNow, shiftToNowErr := config.Get[bool](cr, "shift_to_now")
+	if shiftToNowErr != nil && !errors.Is(shiftToNowErr, config.ErrNotFound) {
+		err = errors.Join(err, shiftToNowErr)
+	} else if shiftToNowErr == nil {
+		newC.ShiftToNow = shiftToNow
+	}
+
+	userPrefix, userPrefixErr := config.Get[string](cr, "user_prefix")
+	if userPrefixErr != nil && !errors.Is(userPrefixErr, config.ErrNotFound) {
+		err = errors.Join(err, userPrefixErr)
+	} else if userPrefixErr == nil {
+		newC.UserPrefix = userPrefix
+	}
+
+	if err == nil && newC.Speed < 0 {
+		err = fmt.Errorf("replay speed must not be negative, got %v", newC.Speed)
+	}
+	if err == nil && newC.File != "" {
+		if _, statErr := os.Stat(newC.File); statErr != nil {
+			err = statErr
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+type replayer struct {
+	c       *ReplayConfig
+	scanner *bufio.Scanner
+	line    int
+	users   map[string]string
+}
+
+func newReplayer(c *ReplayConfig, r io.Reader) *replayer {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &replayer{
+		c:       c,
+		scanner: scanner,
+		users:   make(map[string]string),
+	}
+}
+
+func (r *replayer) Next() (events.ApiEvent, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+		e, err := parseReplayEvent([]byte(line))
+		if err != nil {
+			return e, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		if r.c.UserPrefix != "" {
+			e.UserId = r.remapUser(e.UserId)
+		}
+		return e, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return events.ApiEvent{}, err
+	}
+	return events.ApiEvent{}, io.EOF
+}
+
+func (r *replayer) remapUser(userId string) string {
+	if mapped, ok := r.users[userId]; ok {
+		return mapped
+	}
+	mapped := r.c.UserPrefix + strconv.Itoa(len(r.users))
+	r.users[userId] = mapped
+	return mapped
+}
+
+func parseReplayEvent(line []byte) (events.ApiEvent, error) {
+	e := events.ApiEvent{}
+	raw := make(map[string]any)
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return e, err
+	}
+	var err error
+	for key, v := range raw {
+		switch strings.ReplaceAll(strings.ToLower(key), "_", "") {
+		case "dt":
+			e.Dt, err = parseReplayTime(v)
+		case "event":
+			e.Event = fmt.Sprint(v)
+		case "userid":
+			e.UserId = fmt.Sprint(v)
+		case "screen":
+			e.Screen = fmt.Sprint(v)
+		case "elem":
+			e.Elem = fmt.Sprint(v)
+		case "amount":
+			e.Amount, err = parseReplayInt(v)
+		}
+		if err != nil {
+			return e, fmt.Errorf("field %v: %w", key, err)
+		}
+	}
+	if e.Dt.IsZero() {
+		return e, errors.New("event time is not set")
+	}
+	return e, nil
+}
+
+func parseReplayTime(v any) (time.Time, error) {
+	switch val := v.(type) {
+	case float64:
+		return time.Unix(int64(val), 0).UTC(), nil
+	case string:
+		for _, layout := range replayTimeLayouts {
+			if t, err := time.Parse(layout, val); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unknown time format %q", val)
+	}
+	return time.Time{}, fmt.Errorf("unexpected time value %v", v)
+}
+
+func parseReplayInt(v any) (int, error) {
+	switch val := v.(type) {
+	case float64:
+		return int(val), nil
+	case string:
+		return strconv.Atoi(val)
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unexpected number value %v", v)
+}
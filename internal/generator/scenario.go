@@ -0,0 +1,428 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"example.com/analytics_api/internal/events"
+	"example.com/analytics_api/pkg/config"
+)
+
+const EndEvent = "end"
+
+type AmountSpec struct {
+	Values  []int     `config:"values"`
+	Weights []float64 `config:"weights"`
+}
+
+func (c *AmountSpec) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	values, valuesErr := getNumbers(cr, "values")
+	if valuesErr != nil && !errors.Is(valuesErr, config.ErrNotFound) {
+		err = errors.Join(err, valuesErr)
+	} else if valuesErr == nil {
+		newC.Values = make([]int, len(values))
+		for i, v := range values {
+			newC.Values[i] = int(v)
+		}
+	}
+
+	weights, weightsErr := getNumbers(cr, "weights")
+	if weightsErr != nil && !errors.Is(weightsErr, config.ErrNotFound) {
+		err = errors.Join(err, weightsErr)
+	} else if weightsErr == nil {
+		newC.Weights = weights
+	}
+
+	if err == nil && len(newC.Weights) > 0 && len(newC.Weights) != len(newC.Values) {
+		err = fmt.Errorf("amount weights count %d doesn't match values count %d", len(newC.Weights), len(newC.Values))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+type EventSpec struct {
+	Screens map[string]float64 `config:"screens"`
+	Elems   map[string]float64 `config:"elems"`
+	Amount  AmountSpec         `config:"amount"`
+	Next    map[string]float64 `config:"next"`
+}
+
+func (c *EventSpec) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	screens, screensErr := getWeights(cr, "screens")
+	if screensErr != nil && !errors.Is(screensErr, config.ErrNotFound) {
+		err = errors.Join(err, screensErr)
+	} else if screensErr == nil {
+		newC.Screens = screens
+	}
+
+	elems, elemsErr := getWeights(cr, "elems")
+	if elemsErr != nil && !errors.Is(elemsErr, config.ErrNotFound) {
+		err = errors.Join(err, elemsErr)
+	} else if elemsErr == nil {
+		newC.Elems = elems
+	}
+
+	amountCr, amountErr := config.Sub(cr, "amount")
+	if amountErr != nil && !errors.Is(amountErr, config.ErrNotFound) {
+		err = errors.Join(err, amountErr)
+	} else if amountErr == nil {
+		err = errors.Join(err, newC.Amount.Read(amountCr))
+	}
+
+	next, nextErr := getWeights(cr, "next")
+	if nextErr != nil && !errors.Is(nextErr, config.ErrNotFound) {
+		err = errors.Join(err, nextErr)
+	} else if nextErr == nil {
+		newC.Next = next
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+type Scenario struct {
+	Users      int                   `config:"users"`
+	UserPrefix string                `config:"user_prefix"`
+	Sessions   int                   `config:"sessions"`
+	Seed       int                   `config:"seed"`
+	Start      map[string]float64    `config:"start"`
+	Events     map[string]*EventSpec `config:"events"`
+	Diurnal    []float64             `config:"diurnal"`
+}
+
+func NewScenario() *Scenario {
+	return &Scenario{
+		Users:    1000,
+		Sessions: 100,
+		Start:    make(map[string]float64),
+		Events:   make(map[string]*EventSpec),
+	}
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	cr, err := config.LoadKoanfReader(path)
+	if err != nil {
+		return nil, err
+	}
+	s := NewScenario()
+	if err := s.Read(cr); err != nil {
+		return nil, fmt.Errorf("scenario %v: %w", path, err)
+	}
+	return s, nil
+}
+
+func (c *Scenario) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	users, usersErr := config.Get[int](cr, "users")
+	if usersErr != nil && !errors.Is(usersErr, config.ErrNotFound) {
+		err = errors.Join(err, usersErr)
+	} else if usersErr == nil {
+		newC.Users = users
+	}
+
+	userPrefix, userPrefixErr := config.Get[string](cr, "user_prefix")
+	if userPrefixErr != nil && !errors.Is(userPrefixErr, config.ErrNotFound) {
+		err = errors.Join(err, userPrefixErr)
+	} else if userPrefixErr == nil {
+		newC.UserPrefix = userPrefix
+	}
+
+	sessions, sessionsErr := config.Get[int](cr, "sessions")
+	if sessionsErr != nil && !errors.Is(sessionsErr, config.ErrNotFound) {
+		err = errors.Join(err, sessionsErr)
+	} else if sessionsErr == nil {
+		newC.Sessions = sessions
+	}
+
+	seed, seedErr := config.Get[int](cr, "seed")
+	if seedErr != nil && !errors.Is(seedErr, config.ErrNotFound) {
+		err = errors.Join(err, seedErr)
+	} else if seedErr == nil {
+		newC.Seed = seed
+	}
+
+	start, startErr := getWeights(cr, "start")
+	if startErr != nil && !errors.Is(startErr, config.ErrNotFound) {
+		err = errors.Join(err, startErr)
+	} else if startErr == nil {
+		newC.Start = start
+	}
+
+	newC.Events = make(map[string]*EventSpec)
+	eventsCr, eventsErr := config.Sub(cr, "events")
+	err = errors.Join(err, eventsErr)
+	if eventsErr == nil {
+		for name := range eventsCr.Map() {
+			eventCr, eventErr := config.Sub(eventsCr, name)
+			if eventErr != nil {
+				err = errors.Join(err, eventErr)
+				continue
+			}
+			e := &EventSpec{}
+			if eventErr := e.Read(eventCr); eventErr != nil {
+				err = errors.Join(err, fmt.Errorf("event %v: %w", name, eventErr))
+				continue
+			}
+			newC.Events[name] = e
+		}
+	}
+
+	diurnal, diurnalErr := getNumbers(cr, "diurnal")
+	if diurnalErr != nil && !errors.Is(diurnalErr, config.ErrNotFound) {
+		err = errors.Join(err, diurnalErr)
+	} else if diurnalErr == nil {
+		newC.Diurnal = diurnal
+	}
+
+	if err == nil {
+		err = newC.validate()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+func (c *Scenario) validate() error {
+	var err error
+	if c.Users <= 0 {
+		err = errors.Join(err, fmt.Errorf("users must be positive, got %d", c.Users))
+	}
+	if c.Sessions <= 0 {
+		err = errors.Join(err, fmt.Errorf("sessions must be positive, got %d", c.Sessions))
+	}
+	if len(c.Start) == 0 {
+		err = errors.Join(err, errors.New("start events are not set"))
+	}
+	for name := range c.Start {
+		if _, ok := c.Events[name]; !ok {
+			err = errors.Join(err, fmt.Errorf("start event %v is not described", name))
+		}
+	}
+	for name, e := range c.Events {
+		for next := range e.Next {
+			if _, ok := c.Events[next]; !ok && next != EndEvent {
+				err = errors.Join(err, fmt.Errorf("event %v: next event %v is not described", name, next))
+			}
+		}
+	}
+	if len(c.Diurnal) != 0 && len(c.Diurnal) != 24 {
+		err = errors.Join(err, fmt.Errorf("diurnal curve must have 24 hourly values, got %d", len(c.Diurnal)))
+	}
+	if len(c.Diurnal) != 0 && slices.Max(c.Diurnal) <= 0 {
+		err = errors.Join(err, errors.New("diurnal curve must have a positive value"))
+	}
+	return err
+}
+
+func getNumbers(cr config.IReader, key string) ([]float64, error) {
+	rawList, err := config.GetList[any](cr, key)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]float64, len(rawList))
+	for i, rawV := range rawList {
+		v, ok := toFloat(rawV)
+		if !ok {
+			return nil, fmt.Errorf("config key \"%v[%d]\"; %w: %v %v", key, i, config.ErrWrongType, rawV, reflect.TypeOf(rawV))
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+func getWeights(cr config.IReader, key string) (map[string]float64, error) {
+	sub, err := config.Sub(cr, key)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]float64)
+	for name, rawV := range sub.Map() {
+		v, ok := toFloat(rawV)
+		if !ok || v < 0 {
+			return nil, fmt.Errorf("config key \"%v.%v\"; %w: %v", key, name, config.ErrWrongType, rawV)
+		}
+		result[name] = v
+	}
+	return result, nil
+}
+
+func getFloat(cr config.IReader, key string) (float64, error) {
+	rawV, err := config.Get[any](cr, key)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := toFloat(rawV)
+	if !ok {
+		return 0, fmt.Errorf("config key \"%v\"; %w: %v %v", key, config.ErrWrongType, rawV, reflect.TypeOf(rawV))
+	}
+	return v, nil
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+type weighted[T any] struct {
+	items []T
+	cum   []float64
+}
+
+func newWeighted[T any](items []T, weights []float64) *weighted[T] {
+	w := &weighted[T]{items: items, cum: make([]float64, len(items))}
+	total := 0.0
+	for i := range items {
+		weight := 1.0
+		if i < len(weights) {
+			weight = weights[i]
+		}
+		total += weight
+		w.cum[i] = total
+	}
+	return w
+}
+
+func newWeightedMap(m map[string]float64) *weighted[string] {
+	keys := slices.Sorted(maps.Keys(m))
+	weights := make([]float64, len(keys))
+	for i, k := range keys {
+		weights[i] = m[k]
+	}
+	return newWeighted(keys, weights)
+}
+
+func (w *weighted[T]) pick(rnd *rand.Rand) (T, bool) {
+	var zero T
+	if len(w.items) == 0 || w.cum[len(w.cum)-1] <= 0 {
+		return zero, false
+	}
+	r := rnd.Float64() * w.cum[len(w.cum)-1]
+	i, _ := slices.BinarySearch(w.cum, r)
+	return w.items[min(i, len(w.items)-1)], true
+}
+
+type eventModel struct {
+	screens *weighted[string]
+	elems   *weighted[string]
+	amounts *weighted[int]
+	next    *weighted[string]
+}
+
+type session struct {
+	userId string
+	event  string
+}
+
+type simulator struct {
+	s        *Scenario
+	rnd      *rand.Rand
+	start    *weighted[string]
+	events   map[string]*eventModel
+	sessions []*session
+}
+
+func newSimulator(s *Scenario) *simulator {
+	seed := uint64(s.Seed)
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	sim := &simulator{
+		s:        s,
+		rnd:      rand.New(rand.NewPCG(seed, seed)),
+		start:    newWeightedMap(s.Start),
+		events:   make(map[string]*eventModel, len(s.Events)),
+		sessions: make([]*session, s.Sessions),
+	}
+	for name, e := range s.Events {
+		sim.events[name] = &eventModel{
+			screens: newWeightedMap(e.Screens),
+			elems:   newWeightedMap(e.Elems),
+			amounts: newWeighted(e.Amount.Values, e.Amount.Weights),
+			next:    newWeightedMap(e.Next),
+		}
+	}
+	return sim
+}
+
+func (sim *simulator) newSession() *session {
+	event, _ := sim.start.pick(sim.rnd)
+	return &session{
+		userId: sim.s.UserPrefix + strconv.Itoa(sim.rnd.IntN(sim.s.Users)),
+		event:  event,
+	}
+}
+
+func (sim *simulator) Next(now time.Time) events.ApiEvent {
+	i := sim.rnd.IntN(len(sim.sessions))
+	sess := sim.sessions[i]
+	if sess == nil {
+		sess = sim.newSession()
+		sim.sessions[i] = sess
+	}
+
+	model := sim.events[sess.event]
+	e := events.ApiEvent{
+		Dt:     now,
+		Event:  sess.event,
+		UserId: sess.userId,
+	}
+	e.Screen, _ = model.screens.pick(sim.rnd)
+	e.Elem, _ = model.elems.pick(sim.rnd)
+	e.Amount, _ = model.amounts.pick(sim.rnd)
+
+	next, ok := model.next.pick(sim.rnd)
+	if !ok || next == EndEvent {
+		sim.sessions[i] = nil
+	} else {
+		sess.event = next
+	}
+	return e
+}
+
+func (sim *simulator) RateFactor(now time.Time) float64 {
+	if len(sim.s.Diurnal) == 0 {
+		return 1
+	}
+	peak := slices.Max(sim.s.Diurnal)
+	hour := float64(now.Hour()) + float64(now.Minute())/60
+	lo := int(math.Floor(hour)) % 24
+	hi := (lo + 1) % 24
+	frac := hour - math.Floor(hour)
+	v := sim.s.Diurnal[lo]*(1-frac) + sim.s.Diurnal[hi]*frac
+	return v / peak
+}
@@ -0,0 +1,501 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"example.com/analytics_api/internal/events"
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/service"
+	log "github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	Addr        string        `config:"addr"`
+	Rps         int           `config:"rps"`
+	Concurrency int           `config:"concurrency"`
+	Timeout     time.Duration `config:"timeout"`
+	Scenario    string        `config:"scenario"`
+	MaxQueue    int           `config:"max_queue"`
+	Duration    time.Duration `config:"duration"`
+	Stages      []Stage       `config:"stages"`
+	SLO         SLOConfig     `config:"slo"`
+	Replay      ReplayConfig  `config:"replay"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Addr:        "http://127.0.0.1:8080/events",
+		Concurrency: 32,
+		MaxQueue:    10000,
+		Replay:      *NewReplayConfig(),
+		Timeout:     5 * time.Second,
+	}
+}
+
+func (c *Config) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	addr, addrErr := config.Get[string](cr, "addr")
+	if addrErr != nil && !errors.Is(addrErr, config.ErrNotFound) {
+		err = errors.Join(err, addrErr)
+	} else if addrErr == nil {
+		newC.Addr = addr
+	}
+
+	rps, rpsErr := config.Get[int](cr, "rps")
+	if rpsErr != nil && !errors.Is(rpsErr, config.ErrNotFound) {
+		err = errors.Join(err, rpsErr)
+	} else if rpsErr == nil {
+		newC.Rps = rps
+	}
+
+	concurrency, concurrencyErr := config.Get[int](cr, "concurrency")
+	if concurrencyErr != nil && !errors.Is(concurrencyErr, config.ErrNotFound) {
+		err = errors.Join(err, concurrencyErr)
+	} else if concurrencyErr == nil {
+		newC.Concurrency = concurrency
+	}
+
+	timeout, timeoutErr := config.GetDuration(cr, "timeout")
+	if timeoutErr != nil && !errors.Is(timeoutErr, config.ErrNotFound) {
+		err = errors.Join(err, timeoutErr)
+	} else if timeoutErr == nil {
+		newC.Timeout = timeout
+	}
+
+	scenario, scenarioErr := config.Get[string](cr, "scenario")
+	if scenarioErr != nil && !errors.Is(scenarioErr, config.ErrNotFound) {
+		err = errors.Join(err, scenarioErr)
+	} else if scenarioErr == nil {
+		newC.Scenario = scenario
+	}
+
+	maxQueue, maxQueueErr := config.Get[int](cr, "max_queue")
+	if maxQueueErr != nil && !errors.Is(maxQueueErr, config.ErrNotFound) {
+		err = errors.Join(err, maxQueueErr)
+	} else if maxQueueErr == nil {
+		newC.MaxQueue = maxQueue
+	}
+
+	stages, stagesErr := readStages(cr, "stages")
+	if stagesErr != nil && !errors.Is(stagesErr, config.ErrNotFound) {
+		err = errors.Join(err, stagesErr)
+	} else if stagesErr == nil {
+		newC.Stages = stages
+	}
+
+	duration, durationErr := config.GetDuration(cr, "duration")
+	if durationErr != nil && !errors.Is(durationErr, config.ErrNotFound) {
+		err = errors.Join(err, durationErr)
+	} else if durationErr == nil {
+		newC.Duration = duration
+	}
+
+	sloCr, sloErr := config.Sub(cr, "slo")
+	if sloErr != nil && !errors.Is(sloErr, config.ErrNotFound) {
+		err = errors.Join(err, sloErr)
+	} else if sloErr == nil {
+		err = errors.Join(err, newC.SLO.Read(sloCr))
+	}
+
+	replayCr, replayErr := config.Sub(cr, "replay")
+	if replayErr != nil && !errors.Is(replayErr, config.ErrNotFound) {
+		err = errors.Join(err, replayErr)
+	} else if replayErr == nil {
+		err = errors.Join(err, newC.Replay.Read(replayCr))
+	}
+
+	if err == nil && newC.Concurrency <= 0 {
+		err = fmt.Errorf("concurrency must be positive, got %d", newC.Concurrency)
+	}
+	if err == nil && newC.MaxQueue < 0 {
+		err = fmt.Errorf("max_queue must not be negative, got %d", newC.MaxQueue)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+type generatorService struct {
+	c         *Config
+	logger    *log.Logger
+	client    *http.Client
+	sim       *simulator
+	stats     *stats
+	out       io.Writer
+	seq       int
+	finishing atomic.Bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	m         sync.Mutex
+	done      chan struct{}
+	verdict   error
+}
+
+// IVerdictProvider is implemented by the generator: the SLO verdict of the
+// last run is not a Run error, since a failed run would otherwise stop every
+// service sharing the supervisor.
+type IVerdictProvider interface {
+	Verdict() error
+}
+
+func NewService(opts ...service.Opt) (service.IService, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &generatorService{
+		c:      NewConfig(),
+		logger: log.StandardLogger(),
+		stats:  newStats(),
+		out:    os.Stdout,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	s.client = &http.Client{
+		Timeout: s.c.Timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        s.c.Concurrency,
+			MaxIdleConnsPerHost: s.c.Concurrency,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	return s, nil
+}
+
+var _ service.ILogWriter = (*generatorService)(nil)
+
+func (s *generatorService) SetLogger(l *log.Logger) error {
+	s.logger = l
+	return nil
+}
+
+var _ config.IConfigurable = (*generatorService)(nil)
+
+func (s *generatorService) Configure(cr config.IReader) error {
+	generatorCr, err := config.Sub(cr, "generator")
+	if err != nil {
+		return err
+	}
+	if err := s.c.Read(generatorCr); err != nil {
+		return err
+	}
+	if s.c.Scenario != "" {
+		scenario, err := LoadScenario(s.c.Scenario)
+		if err != nil {
+			return err
+		}
+		s.sim = newSimulator(scenario)
+	}
+	return nil
+}
+
+var _ config.ISchemaProvider = (*generatorService)(nil)
+
+func (s *generatorService) Schema() *config.Schema {
+	return config.SchemaOf(NewConfig())
+}
+
+type job struct {
+	e        events.ApiEvent
+	intended time.Time
+}
+
+var _ service.IRestartable = (*generatorService)(nil)
+
+// Restartable reports that Run may be called again: every run starts with
+// fresh stats and its own done channel.
+func (s *generatorService) Restartable() bool {
+	return true
+}
+
+func (s *generatorService) Run() error {
+	done := make(chan struct{})
+	s.m.Lock()
+	s.done = done
+	s.stats = newStats()
+	s.verdict = nil
+	s.m.Unlock()
+	defer close(done)
+	s.finishing.Store(false)
+	if s.c.Replay.File == "" && s.c.Rps <= 0 && len(s.c.Stages) == 0 {
+		s.logger.Warn("generator disabled")
+		return nil
+	}
+
+	jobs := make(chan job, s.c.MaxQueue)
+	var wg sync.WaitGroup
+	for range s.c.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if s.finishing.Load() {
+					s.stats.Failure("unsent", -1)
+					continue
+				}
+				s.send(j)
+			}
+		}()
+	}
+
+	start := time.Now()
+	s.stats.Start(start)
+	var deadline <-chan time.Time
+	if s.c.Duration > 0 {
+		d := time.NewTimer(s.c.Duration)
+		defer d.Stop()
+		deadline = d.C
+	}
+
+	var completed bool
+	var err error
+	if s.c.Replay.File != "" {
+		completed, err = s.replay(start, jobs, deadline)
+	} else {
+		completed = s.schedule(start, jobs, deadline)
+	}
+	s.finish(jobs, &wg, completed)
+	return err
+}
+
+func (s *generatorService) wait(t *time.Timer, until time.Time, deadline <-chan time.Time) bool {
+	wait := time.Until(until)
+	if wait <= 0 {
+		select {
+		case <-s.ctx.Done():
+			return false
+		case <-deadline:
+			return false
+		default:
+			return true
+		}
+	}
+	t.Reset(wait)
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-deadline:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (s *generatorService) schedule(start time.Time, jobs chan<- job, deadline <-chan time.Time) bool {
+	s.logger.Infof(
+		"start generator at %d rps with %d stages, %d workers and queue of %d",
+		s.c.Rps, len(s.c.Stages), s.c.Concurrency, s.c.MaxQueue,
+	)
+	p := profile{base: float64(s.c.Rps), stages: s.c.Stages}
+	t := time.NewTimer(0)
+	defer t.Stop()
+	intended := start
+	for {
+		rate, ok := p.Rate(intended.Sub(start))
+		if !ok {
+			return true
+		}
+		if s.sim != nil {
+			rate *= s.sim.RateFactor(intended)
+		}
+		if !s.wait(t, intended, deadline) {
+			return false
+		}
+
+		if rate <= 0 {
+			intended = intended.Add(idleStep)
+			continue
+		}
+		s.stats.Scheduled()
+		select {
+		case jobs <- job{e: s.event(intended), intended: intended}:
+		default:
+			s.stats.Failure("dropped", -1)
+			s.logger.Debug("generator queue is full, request dropped")
+		}
+		intended = intended.Add(time.Duration(float64(time.Second) / rate))
+	}
+}
+
+func (s *generatorService) replay(start time.Time, jobs chan<- job, deadline <-chan time.Time) (bool, error) {
+	s.logger.Infof(
+		"start replay of %s at %vx speed with %d workers and queue of %d",
+		s.c.Replay.File, s.c.Replay.Speed, s.c.Concurrency, s.c.MaxQueue,
+	)
+	f, err := os.Open(s.c.Replay.File)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r := newReplayer(&s.c.Replay, f)
+	t := time.NewTimer(0)
+	defer t.Stop()
+	var first time.Time
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		} else if err != nil {
+			return false, fmt.Errorf("replay %v: %w", s.c.Replay.File, err)
+		}
+		if first.IsZero() {
+			first = e.Dt
+		}
+
+		intended := time.Now()
+		if s.c.Replay.Speed > 0 {
+			intended = start.Add(time.Duration(float64(e.Dt.Sub(first)) / s.c.Replay.Speed))
+			if !s.wait(t, intended, deadline) {
+				return false, nil
+			}
+		}
+		if s.c.Replay.ShiftToNow {
+			e.Dt = intended
+		}
+
+		s.stats.Scheduled()
+		if s.c.Replay.Speed > 0 {
+			select {
+			case jobs <- job{e: e, intended: intended}:
+			default:
+				s.stats.Failure("dropped", -1)
+				s.logger.Debug("generator queue is full, request dropped")
+			}
+			continue
+		}
+		select {
+		case jobs <- job{e: e, intended: intended}:
+		case <-s.ctx.Done():
+			return false, nil
+		case <-deadline:
+			return false, nil
+		}
+	}
+}
+
+const idleStep = 100 * time.Millisecond
+
+var _ IVerdictProvider = (*generatorService)(nil)
+
+func (s *generatorService) Verdict() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.verdict
+}
+
+func (s *generatorService) finish(jobs chan job, wg *sync.WaitGroup, drain bool) {
+	s.finishing.Store(!drain)
+	close(jobs)
+	wg.Wait()
+	s.client.CloseIdleConnections()
+	s.stats.Finish(time.Now())
+
+	verdict := s.stats.Verdict(s.c.SLO)
+	s.stats.Summary(s.out, verdict)
+	if verdict != nil {
+		s.logger.WithError(verdict).Error("generator slo violated")
+		sloViolated.Set(1)
+	} else {
+		sloViolated.Set(0)
+	}
+	s.m.Lock()
+	s.verdict = verdict
+	s.m.Unlock()
+}
+
+func (s *generatorService) event(now time.Time) events.ApiEvent {
+	if s.sim != nil {
+		return s.sim.Next(now)
+	}
+	e := events.ApiEvent{
+		Dt:     now.Add(-24 * 365 * time.Hour),
+		Event:  "generator",
+		UserId: strconv.Itoa(s.seq),
+	}
+	s.seq++
+	return e
+}
+
+func (s *generatorService) send(j job) {
+	body, err := json.Marshal(j.e)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.c.Addr, bytes.NewReader(body))
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.stats.Failure(errorKind(err), time.Since(j.intended))
+		s.logger.Error(err)
+		return
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	latency := time.Since(j.intended)
+	if resp.StatusCode != http.StatusOK {
+		s.stats.Failure(fmt.Sprintf("status_%d", resp.StatusCode), latency)
+		s.logger.Errorf("response error %v: %s", resp.Status, respBody)
+		return
+	}
+	s.stats.Success(latency)
+}
+
+func errorKind(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection_reset"
+	}
+	return "transport"
+}
+
+func (s *generatorService) Stop(ctx context.Context) error {
+	s.cancel()
+	s.m.Lock()
+	done := s.done
+	s.m.Unlock()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,275 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/analytics_api/internal/events"
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/service"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator_RunStop(t *testing.T) {
+	var m sync.Mutex
+	received := make([]events.ApiEvent, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := events.ApiEvent{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Lock()
+		received = append(received, e)
+		m.Unlock()
+	}))
+	defer srv.Close()
+
+	s, err := NewService(config.WithReader[service.IService](config.NewMapReader(map[string]any{
+		"generator": map[string]any{"addr": srv.URL, "rps": 200, "concurrency": 2},
+	})))
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.(*generatorService).out = io.Discard
+	done := make(chan error)
+	go func() { done <- s.Run() }()
+	assert.Eventually(t, func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return len(received) >= 10
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, s.Stop(ctx))
+	assert.NoError(t, <-done)
+
+	m.Lock()
+	defer m.Unlock()
+	for _, e := range received {
+		assert.Equal(t, "generator", e.Event)
+	}
+}
+
+func TestConfig_Read(t *testing.T) {
+	c := NewConfig()
+	err := c.Read(config.NewMapReader(map[string]any{"concurrency": 0}))
+	assert.Error(t, err)
+	assert.Equal(t, NewConfig().Concurrency, c.Concurrency)
+}
+
+func TestScenario_Simulation(t *testing.T) {
+	s, err := LoadScenario("../../docker/generator/scenario.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.Seed = 1
+	sim := newSimulator(s)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	counts := make(map[string]int)
+	for range 10000 {
+		e := sim.Next(now)
+		counts[e.Event]++
+		if e.Event == "pay" {
+			assert.Contains(t, []int{100, 500, 1000}, e.Amount)
+			assert.Equal(t, "payment", e.Screen)
+		}
+		assert.NotEmpty(t, e.UserId)
+	}
+	for _, event := range []string{"view", "start_task", "finish_task", "pay"} {
+		assert.Positive(t, counts[event], event)
+	}
+	assert.Greater(t, counts["start_task"], counts["pay"])
+
+	assert.InDelta(t, 0.9, sim.RateFactor(now), 1e-9)
+	assert.InDelta(t, 0.15, sim.RateFactor(now.Add(-11*time.Hour-30*time.Minute)), 1e-9)
+}
+
+func TestScenario_Validate(t *testing.T) {
+	s := NewScenario()
+	err := s.Read(config.NewMapReader(map[string]any{
+		"start": map[string]any{"view": 1},
+		"events": map[string]any{
+			"view": map[string]any{"next": map[string]any{"unknown": 1}},
+		},
+		"diurnal": []any{1, 2},
+	}))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "next event unknown is not described")
+		assert.Contains(t, err.Error(), "24 hourly values")
+	}
+}
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := newHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1000), h.Count())
+	assert.Equal(t, time.Millisecond, h.Quantile(0))
+	assert.Equal(t, 1000*time.Millisecond, h.Quantile(1))
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		expected := float64(time.Duration(q*1000) * time.Millisecond)
+		assert.InEpsilon(t, expected, float64(h.Quantile(q)), 0.02, q)
+	}
+}
+
+func TestGenerator_Restart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	assert.NoError(t, os.WriteFile(file, []byte("not json\n"), 0o644))
+	s, err := NewService(config.WithReader[service.IService](config.NewMapReader(map[string]any{
+		"generator": map[string]any{"replay": map[string]any{"file": file}},
+	})))
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.(*generatorService).out = io.Discard
+	assert.True(t, s.(service.IRestartable).Restartable())
+	for range 3 {
+		assert.ErrorContains(t, s.Run(), "replay "+file)
+	}
+	assert.NoError(t, s.Stop(context.Background()))
+}
+
+func TestGenerator_SLO(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	out := &strings.Builder{}
+	s, err := NewService(config.WithReader[service.IService](config.NewMapReader(map[string]any{
+		"generator": map[string]any{
+			"addr":     srv.URL,
+			"rps":      100,
+			"duration": "300ms",
+			"slo":      map[string]any{"p99": "1ms", "max_error_rate": 0.5},
+		},
+	})))
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.(*generatorService).out = out
+	assert.NoError(t, s.Run())
+	err = s.(IVerdictProvider).Verdict()
+	assert.ErrorIs(t, err, ErrSLO)
+	assert.Contains(t, out.String(), "verdict: FAIL")
+	assert.Contains(t, out.String(), "p99")
+	assert.NotContains(t, err.Error(), "error rate")
+	assert.Equal(t, 1.0, testutil.ToFloat64(sloViolated))
+}
+
+func TestProfile_Rate(t *testing.T) {
+	p := profile{base: 10, stages: []Stage{
+		{Duration: 10 * time.Second, Target: 110},
+		{Duration: 10 * time.Second, Target: 110},
+		{Duration: time.Second, Target: 500},
+	}}
+	for _, tc := range []struct {
+		elapsed time.Duration
+		rate    float64
+	}{
+		{0, 10},
+		{5 * time.Second, 60},
+		{15 * time.Second, 110},
+		{20*time.Second + 500*time.Millisecond, 305},
+	} {
+		rate, ok := p.Rate(tc.elapsed)
+		assert.True(t, ok)
+		assert.InDelta(t, tc.rate, rate, 1e-9, tc.elapsed)
+	}
+	_, ok := p.Rate(21 * time.Second)
+	assert.False(t, ok)
+}
+
+func TestGenerator_OpenModel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	s, err := NewService(config.WithReader[service.IService](config.NewMapReader(map[string]any{
+		"generator": map[string]any{
+			"addr":        srv.URL,
+			"concurrency": 1,
+			"stages":      []any{map[string]any{"duration": "500ms", "target": 100}},
+			"rps":         100,
+		},
+	})))
+	if !assert.NoError(t, err) {
+		return
+	}
+	g := s.(*generatorService)
+	g.out = io.Discard
+	assert.NoError(t, s.Run())
+
+	assert.InDelta(t, 50, g.stats.scheduled, 3)
+	assert.Equal(t, g.stats.scheduled, g.stats.ok)
+	assert.Greater(t, g.stats.latency.max, time.Second)
+}
+
+func TestGenerator_Replay(t *testing.T) {
+	var m sync.Mutex
+	received := make([]events.ApiEvent, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := events.ApiEvent{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Lock()
+		received = append(received, e)
+		m.Unlock()
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "events.ndjson")
+	err := os.WriteFile(file, []byte(
+		`{"Dt":"2025-03-01T11:11:11Z","Event":"view","UserId":"42","Screen":"main"}`+"\n"+
+			"\n"+
+			`{"dt":"2025-03-01 11:11:11","event":"pay","user_id":"7","screen":"payment","amount":"100"}`+"\n"+
+			`{"dt":"2025-03-01 11:11:12","event":"view","user_id":"42"}`+"\n",
+	), 0600)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	s, err := NewService(config.WithReader[service.IService](config.NewMapReader(map[string]any{
+		"generator": map[string]any{
+			"addr":        srv.URL,
+			"concurrency": 1,
+			"replay": map[string]any{
+				"file":         file,
+				"speed":        10,
+				"shift_to_now": true,
+				"user_prefix":  "r_",
+			},
+		},
+	})))
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.(*generatorService).out = io.Discard
+	begin := time.Now()
+	assert.NoError(t, s.Run())
+	assert.GreaterOrEqual(t, time.Since(begin), 100*time.Millisecond)
+
+	m.Lock()
+	defer m.Unlock()
+	if assert.Len(t, received, 3) {
+		assert.Equal(t, []string{"r_0", "r_1", "r_0"}, []string{received[0].UserId, received[1].UserId, received[2].UserId})
+		assert.Equal(t, 100, received[1].Amount)
+		assert.WithinDuration(t, time.Now(), received[2].Dt, time.Second)
+	}
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+)
+
+type Stage struct {
+	Duration time.Duration `config:"duration"`
+	Target   int           `config:"target"`
+}
+
+func (c *Stage) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	duration, durationErr := config.GetDuration(cr, "duration")
+	err = errors.Join(err, durationErr)
+	if durationErr == nil {
+		newC.Duration = duration
+	}
+
+	target, targetErr := config.Get[int](cr, "target")
+	err = errors.Join(err, targetErr)
+	if targetErr == nil {
+		newC.Target = target
+	}
+
+	if err == nil && newC.Duration <= 0 {
+		err = fmt.Errorf("stage duration must be positive, got %s", newC.Duration)
+	}
+	if err == nil && newC.Target < 0 {
+		err = fmt.Errorf("stage target must not be negative, got %d", newC.Target)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+func readStages(cr config.IReader, key string) ([]Stage, error) {
+	rawStages, err := config.GetList[map[string]any](cr, key)
+	if err != nil {
+		return nil, err
+	}
+	stages := make([]Stage, len(rawStages))
+	for i, rawStage := range rawStages {
+		if stageErr := stages[i].Read(config.NewMapReader(rawStage)); stageErr != nil {
+			err = errors.Join(err, fmt.Errorf("stage %d: %w", i, stageErr))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stages, nil
+}
+
+// profile returns the target rate at the given offset from the start of the
+// run; every stage ramps linearly from the previous target, starting at base.
+type profile struct {
+	base   float64
+	stages []Stage
+}
+
+func (p profile) Rate(elapsed time.Duration) (float64, bool) {
+	if len(p.stages) == 0 {
+		return p.base, true
+	}
+	from := p.base
+	for _, st := range p.stages {
+		if elapsed < st.Duration {
+			frac := float64(elapsed) / float64(st.Duration)
+			return from + (float64(st.Target)-from)*frac, true
+		}
+		elapsed -= st.Duration
+		from = float64(st.Target)
+	}
+	return 0, false
+}
@@ -0,0 +1,272 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+)
+
+var ErrSLO = errors.New("slo violated")
+
+// histogram is a log-linear latency histogram in the spirit of HdrHistogram:
+// values are grouped by power of two and each group is split into
+// 2^subBucketBits linear sub-buckets, which bounds the relative error.
+type histogram struct {
+	counts []uint64
+	total  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+const (
+	subBucketBits      = 7
+	subBucketCount     = 1 << subBucketBits
+	subBucketHalfCount = subBucketCount / 2
+)
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]uint64, subBucketCount+(64-subBucketBits)*subBucketHalfCount),
+		min:    time.Duration(math.MaxInt64),
+	}
+}
+
+func bucketIndex(v uint64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	exp := bits.Len64(v) - subBucketBits
+	return subBucketCount + (exp-1)*subBucketHalfCount + int(v>>exp) - subBucketHalfCount
+}
+
+func bucketValue(i int) uint64 {
+	if i < subBucketCount {
+		return uint64(i)
+	}
+	i -= subBucketCount
+	exp := i/subBucketHalfCount + 1
+	top := uint64(i%subBucketHalfCount + subBucketHalfCount)
+	return (top+1)<<exp - 1
+}
+
+func (h *histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[bucketIndex(uint64(d.Microseconds()))]++
+	h.total++
+	h.sum += d
+	h.min = min(h.min, d)
+	h.max = max(h.max, d)
+}
+
+func (h *histogram) Count() uint64 {
+	return h.total
+}
+
+func (h *histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+func (h *histogram) Quantile(q float64) time.Duration {
+	switch {
+	case h.total == 0:
+		return 0
+	case q <= 0:
+		return h.min
+	case q >= 1:
+		return h.max
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	rank = max(rank, 1)
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := time.Duration(bucketValue(i)) * time.Microsecond
+			return min(max(v, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+type SLOConfig struct {
+	P50           time.Duration `config:"p50"`
+	P90           time.Duration `config:"p90"`
+	P99           time.Duration `config:"p99"`
+	P999          time.Duration `config:"p999"`
+	MaxErrorRate  float64       `config:"max_error_rate"`
+	MinThroughput float64       `config:"min_throughput"`
+}
+
+func (c *SLOConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	for key, target := range map[string]*time.Duration{
+		"p50":  &newC.P50,
+		"p90":  &newC.P90,
+		"p99":  &newC.P99,
+		"p999": &newC.P999,
+	} {
+		v, vErr := config.GetDuration(cr, key)
+		if vErr != nil && !errors.Is(vErr, config.ErrNotFound) {
+			err = errors.Join(err, vErr)
+		} else if vErr == nil {
+			*target = v
+		}
+	}
+
+	maxErrorRate, maxErrorRateErr := getFloat(cr, "max_error_rate")
+	if maxErrorRateErr != nil && !errors.Is(maxErrorRateErr, config.ErrNotFound) {
+		err = errors.Join(err, maxErrorRateErr)
+	} else if maxErrorRateErr == nil {
+		newC.MaxErrorRate = maxErrorRate
+	}
+
+	minThroughput, minThroughputErr := getFloat(cr, "min_throughput")
+	if minThroughputErr != nil && !errors.Is(minThroughputErr, config.ErrNotFound) {
+		err = errors.Join(err, minThroughputErr)
+	} else if minThroughputErr == nil {
+		newC.MinThroughput = minThroughput
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+type stats struct {
+	m         sync.Mutex
+	latency   *histogram
+	scheduled uint64
+	ok        uint64
+	errors    map[string]uint64
+	start     time.Time
+	end       time.Time
+}
+
+func newStats() *stats {
+	return &stats{
+		latency: newHistogram(),
+		errors:  make(map[string]uint64),
+	}
+}
+
+func (s *stats) Start(now time.Time) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.start = now
+}
+
+func (s *stats) Finish(now time.Time) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.end = now
+}
+
+func (s *stats) Scheduled() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.scheduled++
+}
+
+func (s *stats) Success(latency time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.ok++
+	s.latency.Record(latency)
+}
+
+func (s *stats) Failure(kind string, latency time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.errors[kind]++
+	if latency >= 0 {
+		s.latency.Record(latency)
+	}
+}
+
+func (s *stats) errorCount() uint64 {
+	var total uint64
+	for _, c := range s.errors {
+		total += c
+	}
+	return total
+}
+
+func (s *stats) Verdict(c SLOConfig) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var err error
+	check := func(name string, q float64, limit time.Duration) {
+		if limit <= 0 {
+			return
+		}
+		if v := s.latency.Quantile(q); v > limit {
+			err = errors.Join(err, fmt.Errorf("%w: %s %s > %s", ErrSLO, name, v, limit))
+		}
+	}
+	check("p50", 0.5, c.P50)
+	check("p90", 0.9, c.P90)
+	check("p99", 0.99, c.P99)
+	check("p99.9", 0.999, c.P999)
+
+	if c.MaxErrorRate > 0 && s.scheduled > 0 {
+		if rate := float64(s.errorCount()) / float64(s.scheduled); rate > c.MaxErrorRate {
+			err = errors.Join(err, fmt.Errorf("%w: error rate %.4f > %.4f", ErrSLO, rate, c.MaxErrorRate))
+		}
+	}
+	if c.MinThroughput > 0 && s.scheduled > 0 {
+		if ratio := float64(s.ok) / float64(s.scheduled); ratio < c.MinThroughput {
+			err = errors.Join(err, fmt.Errorf("%w: throughput ratio %.4f < %.4f", ErrSLO, ratio, c.MinThroughput))
+		}
+	}
+	return err
+}
+
+func (s *stats) Summary(w io.Writer, verdict error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	elapsed := s.end.Sub(s.start).Seconds()
+	if elapsed <= 0 {
+		elapsed = math.SmallestNonzeroFloat64
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "generator summary for %s\n", s.end.Sub(s.start).Round(time.Millisecond))
+	fmt.Fprintf(b, "  requests:   scheduled %d, ok %d, errors %d\n", s.scheduled, s.ok, s.errorCount())
+	fmt.Fprintf(b, "  throughput: requested %.1f rps, achieved %.1f rps\n", float64(s.scheduled)/elapsed, float64(s.ok)/elapsed)
+	fmt.Fprintf(
+		b, "  latency:    (from intended send time) min %s, mean %s, p50 %s, p90 %s, p99 %s, p99.9 %s, max %s\n",
+		s.latency.Quantile(0), s.latency.Mean(), s.latency.Quantile(0.5), s.latency.Quantile(0.9),
+		s.latency.Quantile(0.99), s.latency.Quantile(0.999), s.latency.max,
+	)
+	for _, kind := range slices.Sorted(maps.Keys(s.errors)) {
+		fmt.Fprintf(b, "  error %-20s %d\n", kind+":", s.errors[kind])
+	}
+	if verdict != nil {
+		fmt.Fprintf(b, "  verdict: FAIL\n")
+		for _, line := range strings.Split(verdict.Error(), "\n") {
+			fmt.Fprintf(b, "    %s\n", line)
+		}
+	} else {
+		fmt.Fprintf(b, "  verdict: PASS\n")
+	}
+	io.WriteString(w, b.String())
+}
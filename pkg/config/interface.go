@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 )
 
 var (
@@ -36,6 +37,10 @@ func Get[T any](c IReader, key string) (T, error) {
 	if !ok {
 		return v, fmt.Errorf("config key \"%v\"; %w ", key, ErrNotFound)
 	}
+	rawV, err := resolveSecretRef(rawV)
+	if err != nil {
+		return v, fmt.Errorf("config key \"%v\"; %w", key, err)
+	}
 
 	v, ok = rawV.(T)
 	if !ok {
@@ -44,6 +49,72 @@ func Get[T any](c IReader, key string) (T, error) {
 	return v, nil
 }
 
+// resolveSecretRef substitutes the secret references of a string value.
+func resolveSecretRef(rawV any) (any, error) {
+	if s, isString := rawV.(string); isString && IsSecretRef(s) {
+		return ResolveSecrets(s)
+	}
+	return rawV, nil
+}
+
+// GetDuration reads a duration string; numbers, as JSON and YAML parsers
+// produce them, are seconds.
+func GetDuration(c IReader, key string) (time.Duration, error) {
+	rawV, ok := c.Get(key)
+	if !ok {
+		return 0, fmt.Errorf("config key \"%v\"; %w ", key, ErrNotFound)
+	}
+	switch v := rawV.(type) {
+	case time.Duration:
+		return v, nil
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	}
+	s, err := Get[string](c, key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("config key \"%v\"; %w: %w", key, ErrWrongType, err)
+	}
+	return d, nil
+}
+
+func GetList[T any](c IReader, key string) ([]T, error) {
+	rawV, ok := c.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("config key \"%v\"; %w ", key, ErrNotFound)
+	}
+	var rawList []any
+	switch v := rawV.(type) {
+	case []T:
+		rawList = make([]any, len(v))
+		for i, item := range v {
+			rawList[i] = item
+		}
+	case []any:
+		rawList = v
+	default:
+		return nil, fmt.Errorf("config key \"%v\"; %w: %v %v", key, ErrWrongType, rawV, reflect.TypeOf(rawV).String())
+	}
+	result := make([]T, 0, len(rawList))
+	for i, rawItem := range rawList {
+		rawItem, err := resolveSecretRef(rawItem)
+		if err != nil {
+			return nil, fmt.Errorf("config key \"%v[%d]\"; %w", key, i, err)
+		}
+		item, ok := rawItem.(T)
+		if !ok {
+			return nil, fmt.Errorf("config key \"%v[%d]\"; %w: %v %v", key, i, ErrWrongType, rawItem, reflect.TypeOf(rawItem).String())
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
 func Sub(c IReader, key string) (IReader, error) {
 	v, ok := c.Sub(key)
 	if !ok {
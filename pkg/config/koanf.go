@@ -28,6 +28,26 @@ func NewKoanfReader(configPath string) IReader {
 	return &koanfReader{k: k}
 }
 
+func LoadKoanfReader(configPath string) (IReader, error) {
+	k := koanf.New(".")
+	parser, err := getConfigParser(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.Load(file.Provider(configPath), parser); err != nil {
+		return nil, err
+	}
+	return &koanfReader{k: k}, nil
+}
+
+func Marshal(m map[string]any, format string) ([]byte, error) {
+	parser, err := getConfigParser("." + format)
+	if err != nil {
+		return nil, err
+	}
+	return parser.Marshal(m)
+}
+
 func (cr *koanfReader) Get(field string) (any, bool) {
 	v := cr.k.Get(field)
 	return v, v != nil
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+const RedactedValue = "******"
+
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "dsn"}
+
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func Redact(m map[string]any) map[string]any {
+	result := make(map[string]any, len(m))
+	for k, v := range m {
+		result[k] = redactValue(k, v)
+	}
+	return result
+}
+
+func redactValue(key string, v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		return Redact(val)
+	case []any:
+		result := make([]any, len(val))
+		for i, item := range val {
+			result[i] = redactValue(key, item)
+		}
+		return result
+	case string:
+		if val != "" && IsSensitiveKey(key) {
+			return RedactedValue
+		}
+		return RedactSecrets(RedactString(val))
+	}
+	return v
+}
+
+func RedactString(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return s
+	}
+	return u.Redacted()
+}
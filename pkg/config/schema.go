@@ -0,0 +1,175 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	TagName     = "config"
+)
+
+type Schema struct {
+	Draft                string             `json:"$schema,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Default              any                `json:"default,omitempty"`
+
+	// Types are the schemas of map entries keyed by the value of their
+	// TypeKey property, which defaults to the entry key; used to apply
+	// defaults to entries matched by AdditionalProperties.
+	Types   map[string]*Schema `json:"-"`
+	TypeKey string             `json:"-"`
+}
+
+type ISchemaProvider interface {
+	Schema() *Schema
+}
+
+func NewObjectSchema() *Schema {
+	return &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+}
+
+func SchemaOf(v any) *Schema {
+	return schemaOf(reflect.ValueOf(v))
+}
+
+func schemaOf(v reflect.Value) *Schema {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return schemaOfType(v.Type())
+		}
+		v = v.Elem()
+	}
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		s := &Schema{Type: "string", Format: "duration"}
+		if !v.IsZero() {
+			s.Default = time.Duration(v.Int()).String()
+		}
+		return s
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		s := NewObjectSchema()
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			s.Properties[name] = schemaOf(v.Field(i))
+		}
+		return s
+	case reflect.Slice, reflect.Array, reflect.Map:
+		s := schemaOfType(v.Type())
+		if v.Len() > 0 {
+			s.Default = v.Interface()
+		}
+		return s
+	}
+	s := schemaOfType(v.Type())
+	if !v.IsZero() {
+		s.Default = v.Interface()
+	}
+	return s
+}
+
+func schemaOfType(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return &Schema{Type: "string", Format: "duration"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOfType(t.Elem())}
+	case reflect.Struct:
+		return schemaOf(reflect.New(t).Elem())
+	}
+	return &Schema{}
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag := f.Tag.Get(TagName)
+	if tag == "-" {
+		return "", false
+	}
+	if tag != "" {
+		return tag, true
+	}
+	return strings.ToLower(f.Name), true
+}
+
+// ApplyDefaults fills m with the defaults of s. Top-level sections absent
+// from m stay absent, since they may belong to services that do not run;
+// inside a present section absent nested objects are filled as well, except
+// for entries of map-like objects, which exist only when configured.
+func ApplyDefaults(s *Schema, m map[string]any) map[string]any {
+	return applyDefaults(s, m, false)
+}
+
+func applyDefaults(s *Schema, m map[string]any, nested bool) map[string]any {
+	result := maps.Clone(m)
+	if result == nil {
+		result = make(map[string]any)
+	}
+	if s == nil {
+		return result
+	}
+	if s.AdditionalProperties != nil && len(s.Types) > 0 {
+		for key, v := range result {
+			sub, ok := v.(map[string]any)
+			if _, known := s.Properties[key]; known || !ok {
+				continue
+			}
+			typ, ok := sub[s.TypeKey].(string)
+			if !ok {
+				typ = key
+			}
+			if typeSchema, ok := s.Types[typ]; ok {
+				result[key] = applyDefaults(typeSchema, sub, true)
+			}
+		}
+	}
+	for key, prop := range s.Properties {
+		v, found := result[key]
+		switch {
+		case prop.Type == "object" && len(prop.Properties) > 0:
+			if sub, ok := v.(map[string]any); ok {
+				result[key] = applyDefaults(prop, sub, true)
+			} else if !found && nested && s.AdditionalProperties == nil {
+				if sub := applyDefaults(prop, nil, true); len(sub) > 0 {
+					result[key] = sub
+				}
+			}
+		case !found && prop.Default != nil:
+			result[key] = prop.Default
+		}
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"example.com/analytics_api/pkg/registry"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrSecret = errors.New("secret not resolved")
+
+	secretRefRe = regexp.MustCompile(`\$\{(file|env):([^}]+)\}`)
+	secrets     = registry.NewRegistry[struct{}]()
+)
+
+func IsSecretRef(s string) bool {
+	return secretRefRe.MatchString(s)
+}
+
+func ResolveSecrets(s string) (string, error) {
+	var err error
+	resolved := secretRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		m := secretRefRe.FindStringSubmatch(ref)
+		v, refErr := resolveSecret(m[1], m[2])
+		if refErr != nil {
+			err = errors.Join(err, refErr)
+			return ref
+		}
+		registerSecret(v)
+		return v
+	})
+	if err != nil {
+		return s, err
+	}
+	return resolved, nil
+}
+
+func registerSecret(v string) {
+	if v == "" {
+		return
+	}
+	secrets.Register(v, struct{}{})
+	if u, err := url.Parse(v); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok && password != "" {
+			secrets.Register(password, struct{}{})
+		}
+	}
+}
+
+func resolveSecret(scheme, ref string) (string, error) {
+	switch scheme {
+	case "file":
+		b, err := os.ReadFile(ref)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrSecret, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case "env":
+		v, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("%w: env %v is not set", ErrSecret, ref)
+		}
+		return v, nil
+	}
+	return "", fmt.Errorf("%w: unknown scheme %v", ErrSecret, scheme)
+}
+
+func RedactSecrets(s string) string {
+	known := slices.Collect(maps.Keys(secrets.All()))
+	slices.SortFunc(known, func(a, b string) int { return len(b) - len(a) })
+	for _, secret := range known {
+		s = strings.ReplaceAll(s, secret, RedactedValue)
+	}
+	return s
+}
+
+type redactingFormatter struct {
+	f log.Formatter
+}
+
+func NewRedactingFormatter(f log.Formatter) log.Formatter {
+	return &redactingFormatter{f: f}
+}
+
+func (r *redactingFormatter) Format(e *log.Entry) ([]byte, error) {
+	b, err := r.f.Format(e)
+	if err != nil {
+		return b, err
+	}
+	return []byte(RedactSecrets(string(b))), nil
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+)
+
+const (
+	CodeInvalidBody                = "invalid_body"
+	CodeUnsupportedContentType     = "unsupported_content_type"
+	CodeUnsupportedContentEncoding = "unsupported_content_encoding"
+	CodeValidationFailed           = "validation_failed"
+	CodeUnknownFields              = "unknown_fields"
+	CodeStorageError               = "storage_error"
+	CodeInternalError              = "internal_error"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error is returned by handlers to produce an error response; Err is the
+// cause, which is logged but not sent to the client.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func NewError(status int, code, message string, err error) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorResponse is the body of every error response of the API.
+type ErrorResponse struct {
+	Code      string       `json:"code" validate:"required"`
+	Message   string       `json:"message" validate:"required"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// CodeOf returns the error code for a status without a more specific one,
+// e.g. "not_found" for 404.
+func CodeOf(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return CodeInternalError
+	}
+	b := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			b = append(b, byte(r-'A'+'a'))
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b = append(b, byte(r))
+		case len(b) > 0 && b[len(b)-1] != '_':
+			b = append(b, '_')
+		}
+	}
+	return string(b)
+}
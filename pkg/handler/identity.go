@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientSubject returns the subject of the client certificate verified during
+// the TLS handshake, or an empty string for plain or unauthenticated requests.
+func ClientSubject(c *fiber.Ctx) string {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.String()
+}
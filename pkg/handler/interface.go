@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"context"
+
+	"example.com/analytics_api/pkg/openapi"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -9,6 +12,34 @@ type IHandler interface {
 	AddRoutes(rg fiber.Router)
 }
 
+// IStarter is called by the API service before it starts listening; an
+// error aborts the start.
+type IStarter interface {
+	Start(ctx context.Context) error
+}
+
+// IStopper is called by the API service after it stopped serving requests.
+type IStopper interface {
+	Stop(ctx context.Context) error
+}
+
+// IFlusher is called by the API service while draining, after it stopped
+// serving requests and before IStopper, to write out buffered events.
+type IFlusher interface {
+	Flush(ctx context.Context) error
+}
+
+// IHealthChecker is called by readiness probes.
+type IHealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// IDocumenter describes the handler routes, relative to Path, for the
+// OpenAPI document.
+type IDocumenter interface {
+	Routes() []openapi.Route
+}
+
 type Opt func(IHandler) error
 
 type Constructor func(opts ...Opt) (IHandler, error)
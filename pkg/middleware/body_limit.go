@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+
+	"example.com/analytics_api/pkg/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+const BodyLimit = "body_limit"
+
+type BodyLimitConfig struct {
+	Limit int `config:"limit"`
+}
+
+func NewBodyLimitConfig() *BodyLimitConfig {
+	return &BodyLimitConfig{
+		Limit: 64 * 1024,
+	}
+}
+
+func (c *BodyLimitConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	limit, limitErr := config.Get[int](cr, "limit")
+	if limitErr != nil && !errors.Is(limitErr, config.ErrNotFound) {
+		err = errors.Join(err, limitErr)
+	} else if limitErr == nil {
+		newC.Limit = limit
+	}
+
+	if err == nil && newC.Limit <= 0 {
+		err = fmt.Errorf("body limit must be positive, got %d", newC.Limit)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+// NewBodyLimit rejects requests with a body larger than the limit; the app
+// wide fiber.Config.BodyLimit still caps what is read from the connection.
+// The body is measured as received: Ctx.Body would decompress it without
+// any limit, which is left to the handlers.
+func NewBodyLimit(cr config.IReader) (fiber.Handler, error) {
+	c := NewBodyLimitConfig()
+	if err := c.Read(cr); err != nil {
+		return nil, err
+	}
+	return func(ctx *fiber.Ctx) error {
+		if ctx.Request().Header.ContentLength() > c.Limit || len(ctx.BodyRaw()) > c.Limit {
+			return fiber.ErrRequestEntityTooLarge
+		}
+		return ctx.Next()
+	}, nil
+}
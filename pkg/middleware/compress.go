@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+
+	"example.com/analytics_api/pkg/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+)
+
+const Compress = "compress"
+
+type CompressConfig struct {
+	Level int `config:"level"`
+}
+
+func NewCompressConfig() *CompressConfig {
+	return &CompressConfig{
+		Level: int(compress.LevelDefault),
+	}
+}
+
+func (c *CompressConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	level, levelErr := config.Get[int](cr, "level")
+	if levelErr != nil && !errors.Is(levelErr, config.ErrNotFound) {
+		err = errors.Join(err, levelErr)
+	} else if levelErr == nil {
+		newC.Level = level
+	}
+
+	if err == nil && (newC.Level < int(compress.LevelDisabled) || newC.Level > int(compress.LevelBestCompression)) {
+		err = fmt.Errorf("compress level must be in [-1, 2], got %d", newC.Level)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+// NewCompress compresses responses according to Accept-Encoding.
+func NewCompress(cr config.IReader) (fiber.Handler, error) {
+	c := NewCompressConfig()
+	if err := c.Read(cr); err != nil {
+		return nil, err
+	}
+	return compress.New(compress.Config{
+		Level: compress.Level(c.Level),
+	}), nil
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"example.com/analytics_api/pkg/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+const Cors = "cors"
+
+type CorsConfig struct {
+	AllowOrigins     []string `config:"allow_origins"`
+	AllowMethods     []string `config:"allow_methods"`
+	AllowHeaders     []string `config:"allow_headers"`
+	AllowCredentials bool     `config:"allow_credentials"`
+	MaxAge           int      `config:"max_age"`
+}
+
+func NewCorsConfig() *CorsConfig {
+	return &CorsConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{fiber.MethodGet, fiber.MethodPost, fiber.MethodHead, fiber.MethodOptions},
+	}
+}
+
+func (c *CorsConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	for key, target := range map[string]*[]string{
+		"allow_origins": &newC.AllowOrigins,
+		"allow_methods": &newC.AllowMethods,
+		"allow_headers": &newC.AllowHeaders,
+	} {
+		v, vErr := config.GetList[string](cr, key)
+		if vErr != nil && !errors.Is(vErr, config.ErrNotFound) {
+			err = errors.Join(err, vErr)
+		} else if vErr == nil {
+			*target = v
+		}
+	}
+
+	allowCredentials, allowCredentialsErr := config.Get[bool](cr, "allow_credentials")
+	if allowCredentialsErr != nil && !errors.Is(allowCredentialsErr, config.ErrNotFound) {
+		err = errors.Join(err, allowCredentialsErr)
+	} else if allowCredentialsErr == nil {
+		newC.AllowCredentials = allowCredentials
+	}
+
+	maxAge, maxAgeErr := config.Get[int](cr, "max_age")
+	if maxAgeErr != nil && !errors.Is(maxAgeErr, config.ErrNotFound) {
+		err = errors.Join(err, maxAgeErr)
+	} else if maxAgeErr == nil {
+		newC.MaxAge = maxAge
+	}
+
+	if err == nil && newC.AllowCredentials && slices.Contains(newC.AllowOrigins, "*") {
+		err = errors.New("cors allow_credentials can not be used with wildcard origin")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+func NewCors(cr config.IReader) (fiber.Handler, error) {
+	c := NewCorsConfig()
+	if err := c.Read(cr); err != nil {
+		return nil, err
+	}
+	return cors.New(cors.Config{
+		AllowOrigins:     strings.Join(c.AllowOrigins, ","),
+		AllowMethods:     strings.Join(c.AllowMethods, ","),
+		AllowHeaders:     strings.Join(c.AllowHeaders, ","),
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}), nil
+}
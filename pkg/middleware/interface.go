@@ -0,0 +1,13 @@
+package middleware
+
+import (
+	"example.com/analytics_api/pkg/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Constructor func(cr config.IReader) (fiber.Handler, error)
+
+type IFactory interface {
+	RegisterMiddleware(name string, c Constructor) error
+	BuildMiddleware(name string, cr config.IReader) (fiber.Handler, error)
+}
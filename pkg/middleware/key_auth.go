@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"example.com/analytics_api/pkg/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/keyauth"
+)
+
+const KeyAuth = "key_auth"
+
+type KeyAuthConfig struct {
+	Header  string   `config:"header"`
+	ApiKeys []string `config:"api_keys"`
+}
+
+func NewKeyAuthConfig() *KeyAuthConfig {
+	return &KeyAuthConfig{
+		Header: "X-API-Key",
+	}
+}
+
+func (c *KeyAuthConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	header, headerErr := config.Get[string](cr, "header")
+	if headerErr != nil && !errors.Is(headerErr, config.ErrNotFound) {
+		err = errors.Join(err, headerErr)
+	} else if headerErr == nil {
+		newC.Header = header
+	}
+
+	keys, keysErr := config.GetList[string](cr, "api_keys")
+	err = errors.Join(err, keysErr)
+	if keysErr == nil {
+		newC.ApiKeys = keys
+	}
+
+	if err == nil && len(newC.ApiKeys) == 0 {
+		err = errors.New("key_auth requires at least one api key")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+// NewKeyAuth accepts only requests carrying one of the configured API keys.
+func NewKeyAuth(cr config.IReader) (fiber.Handler, error) {
+	c := NewKeyAuthConfig()
+	if err := c.Read(cr); err != nil {
+		return nil, err
+	}
+	return keyauth.New(keyauth.Config{
+		KeyLookup: "header:" + c.Header,
+		Validator: func(_ *fiber.Ctx, key string) (bool, error) {
+			for _, k := range c.ApiKeys {
+				if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+					return true, nil
+				}
+			}
+			return false, keyauth.ErrMissingOrMalformedAPIKey
+		},
+		ErrorHandler: func(*fiber.Ctx, error) error {
+			return fiber.NewError(fiber.StatusUnauthorized, keyauth.ErrMissingOrMalformedAPIKey.Error())
+		},
+	}), nil
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+const Limiter = "limiter"
+
+type LimiterConfig struct {
+	Max        int           `config:"max"`
+	Expiration time.Duration `config:"expiration"`
+}
+
+func NewLimiterConfig() *LimiterConfig {
+	return &LimiterConfig{
+		Max:        100,
+		Expiration: time.Minute,
+	}
+}
+
+func (c *LimiterConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	maxRequests, maxErr := config.Get[int](cr, "max")
+	if maxErr != nil && !errors.Is(maxErr, config.ErrNotFound) {
+		err = errors.Join(err, maxErr)
+	} else if maxErr == nil {
+		newC.Max = maxRequests
+	}
+
+	expiration, expirationErr := config.GetDuration(cr, "expiration")
+	if expirationErr != nil && !errors.Is(expirationErr, config.ErrNotFound) {
+		err = errors.Join(err, expirationErr)
+	} else if expirationErr == nil {
+		newC.Expiration = expiration
+	}
+
+	if err == nil && newC.Max <= 0 {
+		err = fmt.Errorf("limiter max must be positive, got %d", newC.Max)
+	}
+	if err == nil && newC.Expiration <= 0 {
+		err = fmt.Errorf("limiter expiration must be positive, got %s", newC.Expiration)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+// NewLimiter limits requests per client IP in a sliding window.
+func NewLimiter(cr config.IReader) (fiber.Handler, error) {
+	c := NewLimiterConfig()
+	if err := c.Read(cr); err != nil {
+		return nil, err
+	}
+	return limiter.New(limiter.Config{
+		Max:               c.Max,
+		Expiration:        c.Expiration,
+		LimiterMiddleware: limiter.SlidingWindow{},
+		LimitReached: func(*fiber.Ctx) error {
+			return fiber.ErrTooManyRequests
+		},
+	}), nil
+}
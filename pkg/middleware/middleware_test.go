@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/analytics_api/pkg/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestApp(t *testing.T, c Constructor, m map[string]any) *fiber.App {
+	mw, err := c(config.NewMapReader(m))
+	require.NoError(t, err)
+	app := fiber.New()
+	app.Use(mw)
+	app.Post("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app
+}
+
+func TestKeyAuth(t *testing.T) {
+	t.Setenv("TEST_API_KEY", "from-env")
+	app := newTestApp(t, NewKeyAuth, map[string]any{
+		"api_keys": []any{"plain", "${env:TEST_API_KEY}"},
+	})
+	for key, code := range map[string]int{
+		"plain":    fiber.StatusOK,
+		"from-env": fiber.StatusOK,
+		"wrong":    fiber.StatusUnauthorized,
+		"":         fiber.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(fiber.MethodPost, "/", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, code, resp.StatusCode, key)
+	}
+
+	_, err := NewKeyAuth(config.NewMapReader(map[string]any{}))
+	assert.Error(t, err)
+}
+
+func TestBodyLimit(t *testing.T) {
+	app := newTestApp(t, NewBodyLimit, map[string]any{"limit": 4})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader("1234")))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader("12345")))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestConfig_Validation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		c Constructor
+		m map[string]any
+	}{
+		"cors credentials with wildcard": {NewCors, map[string]any{"allow_credentials": true}},
+		"limiter zero max":               {NewLimiter, map[string]any{"max": 0}},
+		"compress level":                 {NewCompress, map[string]any{"level": 5}},
+		"body limit negative":            {NewBodyLimit, map[string]any{"limit": -1}},
+	} {
+		_, err := tc.c(config.NewMapReader(tc.m))
+		assert.Error(t, err, name)
+	}
+}
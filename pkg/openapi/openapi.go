@@ -0,0 +1,250 @@
+package openapi
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI string               `json:"openapi"`
+	Info    Info                 `json:"info"`
+	Paths   map[string]*PathItem `json:"paths"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem maps lower case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// QueryParameters returns a query parameter for every property of an object
+// schema, in name order.
+func QueryParameters(s *Schema) []*Parameter {
+	params := make([]*Parameter, 0, len(s.Properties))
+	for _, name := range slices.Sorted(maps.Keys(s.Properties)) {
+		params = append(params, &Parameter{
+			Name:     name,
+			In:       "query",
+			Required: slices.Contains(s.Required, name),
+			Schema:   s.Properties[name],
+		})
+	}
+	return params
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+// Route is an operation on a path relative to the handler group.
+type Route struct {
+	Method    string
+	Path      string
+	Operation *Operation
+}
+
+func NewDocument(title, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]*PathItem),
+	}
+}
+
+// Add registers the routes under the prefix, tagging them with tag and
+// prefixing operation IDs with it, so several instances of one handler type
+// do not collide.
+func (d *Document) Add(prefix, tag string, routes []Route) {
+	for _, r := range routes {
+		path := strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(r.Path, "/")
+		item, ok := d.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			d.Paths[path] = item
+		}
+		op := *r.Operation
+		op.Tags = append(slices.Clone(op.Tags), tag)
+		if op.OperationID != "" {
+			op.OperationID = tag + "." + op.OperationID
+		}
+		(*item)[strings.ToLower(r.Method)] = &op
+	}
+}
+
+// JSONContent returns a content map for the schema under the given media
+// types, application/json if none are given.
+func JSONContent(s *Schema, mediaTypes ...string) map[string]*MediaType {
+	if len(mediaTypes) == 0 {
+		mediaTypes = []string{"application/json"}
+	}
+	content := make(map[string]*MediaType, len(mediaTypes))
+	for _, mt := range mediaTypes {
+		content[mt] = &MediaType{Schema: s}
+	}
+	return content
+}
+
+// SchemaOf describes a request or response type by reflection. Properties
+// are named by their json tag, or the lower case field name, and constraints
+// are taken from go-playground/validator tags.
+func SchemaOf(v any) *Schema {
+	return schemaOfType(reflect.TypeOf(v))
+}
+
+func schemaOfType(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOfType(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			prop := schemaOfType(f.Type)
+			if applyValidateTag(prop, f.Tag.Get("validate")) {
+				s.Required = append(s.Required, name)
+			}
+			s.Properties[name] = prop
+		}
+		return s
+	}
+	return &Schema{}
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return strings.ToLower(f.Name), true
+	}
+	return name, true
+}
+
+// applyValidateTag adds the constraints of a validate tag to the schema and
+// reports whether the field is required.
+func applyValidateTag(s *Schema, tag string) bool {
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url", "uri":
+			s.Format = "uri"
+		case "uuid", "uuid4":
+			s.Format = "uuid"
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				s.Enum = append(s.Enum, v)
+			}
+		case "min", "gte":
+			setBound(s, param, true)
+		case "max", "lte":
+			setBound(s, param, false)
+		case "len":
+			setBound(s, param, true)
+			setBound(s, param, false)
+		}
+	}
+	return required
+}
+
+func setBound(s *Schema, param string, lower bool) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	switch s.Type {
+	case "string":
+		i := int(n)
+		if lower {
+			s.MinLength = &i
+		} else {
+			s.MaxLength = &i
+		}
+	case "integer", "number":
+		if lower {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+	}
+}
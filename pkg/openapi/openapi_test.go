@@ -0,0 +1,65 @@
+package openapi
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testEvent struct {
+	Dt      time.Time `validate:"required"`
+	Name    string    `json:"name" validate:"required,min=1,max=64"`
+	Kind    string    `json:"kind,omitempty" validate:"oneof=view click"`
+	Amount  int       `validate:"gte=0,lte=1000"`
+	Email   string    `validate:"omitempty,email"`
+	Tags    []string
+	Ignored string `json:"-"`
+	private string
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(testEvent{})
+	assert.Equal(t, "object", s.Type)
+	assert.Equal(t, []string{"dt", "name"}, s.Required)
+	assert.ElementsMatch(t, []string{"dt", "name", "kind", "amount", "email", "tags"}, slices.Collect(maps.Keys(s.Properties)))
+
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, s.Properties["dt"])
+	assert.Equal(t, 1, *s.Properties["name"].MinLength)
+	assert.Equal(t, 64, *s.Properties["name"].MaxLength)
+	assert.Equal(t, []any{"view", "click"}, s.Properties["kind"].Enum)
+	assert.Equal(t, 0.0, *s.Properties["amount"].Minimum)
+	assert.Equal(t, 1000.0, *s.Properties["amount"].Maximum)
+	assert.Equal(t, "email", s.Properties["email"].Format)
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "string"}}, s.Properties["tags"])
+}
+
+func TestDocument_Add(t *testing.T) {
+	routes := []Route{{
+		Method:    "POST",
+		Path:      "/",
+		Operation: &Operation{OperationID: "postEvent", Responses: map[string]*Response{}},
+	}}
+	d := NewDocument("test", "1")
+	d.Add("/events", "events", routes)
+	d.Add("/events-test/", "events-test", routes)
+
+	assert.Equal(t, "events.postEvent", (*d.Paths["/events/"])["post"].OperationID)
+	assert.Equal(t, []string{"events-test"}, (*d.Paths["/events-test/"])["post"].Tags)
+	assert.Equal(t, "postEvent", routes[0].Operation.OperationID)
+}
+
+func TestQueryParameters(t *testing.T) {
+	params := QueryParameters(SchemaOf(testEvent{}))
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Name
+		assert.Equal(t, "query", p.In)
+	}
+	assert.Equal(t, []string{"amount", "dt", "email", "kind", "name", "tags"}, names)
+	assert.True(t, params[1].Required)
+	assert.Equal(t, "date-time", params[1].Schema.Format)
+	assert.False(t, params[0].Required)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -25,3 +26,33 @@ func WithLogger(l *log.Logger) Opt {
 		return nil
 	}
 }
+
+type IReadyNotifier interface {
+	Ready() <-chan struct{}
+}
+
+// IStopTimeoutProvider is implemented by services that know how long they
+// need to stop; the supervisor waits at least that long unless the unit has
+// its own stop_timeout.
+type IStopTimeoutProvider interface {
+	StopTimeout() time.Duration
+}
+
+// IRestartable is implemented by services whose Run may be called again
+// after it failed; the supervisor restarts only such services.
+type IRestartable interface {
+	Restartable() bool
+}
+
+type ISupervisor interface {
+	Add(name string, svc IService, dependsOn ...string) error
+}
+
+func WithService(name string, svc IService, dependsOn ...string) Opt {
+	return func(s IService) error {
+		if i, ok := s.(ISupervisor); ok {
+			return i.Add(name, svc, dependsOn...)
+		}
+		return nil
+	}
+}
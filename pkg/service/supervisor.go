@@ -0,0 +1,468 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrCycle        = errors.New("dependency cycle")
+	ErrStartTimeout = errors.New("start timeout")
+)
+
+type State string
+
+const (
+	StatePending    State = "pending"
+	StateStarting   State = "starting"
+	StateRunning    State = "running"
+	StateRestarting State = "restarting"
+	StateStopping   State = "stopping"
+	StateStopped    State = "stopped"
+	StateFailed     State = "failed"
+)
+
+type UnitConfig struct {
+	DependsOn   []string      `config:"depends_on"`
+	Restart     bool          `config:"restart"`
+	MaxRestarts int           `config:"max_restarts"`
+	Backoff     time.Duration `config:"backoff"`
+	MaxBackoff  time.Duration `config:"max_backoff"`
+	StopTimeout time.Duration `config:"stop_timeout"`
+}
+
+func NewUnitConfig() *UnitConfig {
+	return &UnitConfig{
+		Backoff:    time.Second,
+		MaxBackoff: 30 * time.Second,
+	}
+}
+
+func (c *UnitConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	dependsOn, dependsOnErr := config.GetList[string](cr, "depends_on")
+	if dependsOnErr != nil && !errors.Is(dependsOnErr, config.ErrNotFound) {
+		err = errors.Join(err, dependsOnErr)
+	} else if dependsOnErr == nil {
+		newC.DependsOn = dependsOn
+	}
+
+	restart, restartErr := config.Get[bool](cr, "restart")
+	if restartErr != nil && !errors.Is(restartErr, config.ErrNotFound) {
+		err = errors.Join(err, restartErr)
+	} else if restartErr == nil {
+		newC.Restart = restart
+	}
+
+	maxRestarts, maxRestartsErr := config.Get[int](cr, "max_restarts")
+	if maxRestartsErr != nil && !errors.Is(maxRestartsErr, config.ErrNotFound) {
+		err = errors.Join(err, maxRestartsErr)
+	} else if maxRestartsErr == nil {
+		newC.MaxRestarts = maxRestarts
+	}
+
+	backoff, backoffErr := config.GetDuration(cr, "backoff")
+	if backoffErr != nil && !errors.Is(backoffErr, config.ErrNotFound) {
+		err = errors.Join(err, backoffErr)
+	} else if backoffErr == nil {
+		newC.Backoff = backoff
+	}
+
+	maxBackoff, maxBackoffErr := config.GetDuration(cr, "max_backoff")
+	if maxBackoffErr != nil && !errors.Is(maxBackoffErr, config.ErrNotFound) {
+		err = errors.Join(err, maxBackoffErr)
+	} else if maxBackoffErr == nil {
+		newC.MaxBackoff = maxBackoff
+	}
+
+	stopTimeout, stopTimeoutErr := config.GetDuration(cr, "stop_timeout")
+	if stopTimeoutErr != nil && !errors.Is(stopTimeoutErr, config.ErrNotFound) {
+		err = errors.Join(err, stopTimeoutErr)
+	} else if stopTimeoutErr == nil {
+		newC.StopTimeout = stopTimeout
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+type SupervisorConfig struct {
+	StartTimeout time.Duration          `config:"start_timeout"`
+	StopTimeout  time.Duration          `config:"stop_timeout"`
+	Services     map[string]*UnitConfig `config:"services"`
+}
+
+func NewSupervisorConfig() *SupervisorConfig {
+	return &SupervisorConfig{
+		StartTimeout: 10 * time.Second,
+		StopTimeout:  3 * time.Second,
+		Services:     make(map[string]*UnitConfig),
+	}
+}
+
+func (c *SupervisorConfig) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	startTimeout, startTimeoutErr := config.GetDuration(cr, "start_timeout")
+	if startTimeoutErr != nil && !errors.Is(startTimeoutErr, config.ErrNotFound) {
+		err = errors.Join(err, startTimeoutErr)
+	} else if startTimeoutErr == nil {
+		newC.StartTimeout = startTimeout
+	}
+
+	stopTimeout, stopTimeoutErr := config.GetDuration(cr, "stop_timeout")
+	if stopTimeoutErr != nil && !errors.Is(stopTimeoutErr, config.ErrNotFound) {
+		err = errors.Join(err, stopTimeoutErr)
+	} else if stopTimeoutErr == nil {
+		newC.StopTimeout = stopTimeout
+	}
+
+	newC.Services = make(map[string]*UnitConfig)
+	servicesCr, servicesErr := config.Sub(cr, "services")
+	if servicesErr != nil && !errors.Is(servicesErr, config.ErrNotFound) {
+		err = errors.Join(err, servicesErr)
+	} else if servicesErr == nil {
+		for name := range servicesCr.Map() {
+			unitCr, unitErr := config.Sub(servicesCr, name)
+			if unitErr != nil {
+				err = errors.Join(err, unitErr)
+				continue
+			}
+			unitC := NewUnitConfig()
+			if unitErr := unitC.Read(unitCr); unitErr != nil {
+				err = errors.Join(err, fmt.Errorf("service %v: %w", name, unitErr))
+				continue
+			}
+			newC.Services[name] = unitC
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+type unit struct {
+	name      string
+	svc       IService
+	dependsOn []string
+	state     atomic.Value
+	done      chan struct{}
+}
+
+func (u *unit) setState(s State) {
+	u.state.Store(s)
+}
+
+func (u *unit) State() State {
+	return u.state.Load().(State)
+}
+
+type Supervisor struct {
+	c       *SupervisorConfig
+	logger  *log.Logger
+	units   []*unit
+	m       sync.Mutex
+	started atomic.Bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func NewSupervisor(opts ...Opt) (*Supervisor, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Supervisor{
+		c:      NewSupervisorConfig(),
+		logger: log.StandardLogger(),
+		units:  make([]*unit, 0),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+var _ ILogWriter = (*Supervisor)(nil)
+
+func (s *Supervisor) SetLogger(l *log.Logger) error {
+	s.logger = l
+	return nil
+}
+
+var _ config.IConfigurable = (*Supervisor)(nil)
+
+func (s *Supervisor) Configure(cr config.IReader) error {
+	supervisorCr, err := config.Sub(cr, "supervisor")
+	if errors.Is(err, config.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return s.c.Read(supervisorCr)
+}
+
+var _ config.ISchemaProvider = (*Supervisor)(nil)
+
+func (s *Supervisor) Schema() *config.Schema {
+	return config.SchemaOf(NewSupervisorConfig())
+}
+
+var _ ISupervisor = (*Supervisor)(nil)
+
+func (s *Supervisor) Add(name string, svc IService, dependsOn ...string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if slices.IndexFunc(s.units, func(u *unit) bool { return u.name == name }) >= 0 {
+		return fmt.Errorf("service %v already added", name)
+	}
+	u := &unit{
+		name:      name,
+		svc:       svc,
+		dependsOn: dependsOn,
+		done:      make(chan struct{}),
+	}
+	u.setState(StatePending)
+	s.units = append(s.units, u)
+	return nil
+}
+
+func (s *Supervisor) Status() map[string]State {
+	s.m.Lock()
+	defer s.m.Unlock()
+	status := make(map[string]State, len(s.units))
+	for _, u := range s.units {
+		status[u.name] = u.State()
+	}
+	return status
+}
+
+func (s *Supervisor) unitConfig(name string) *UnitConfig {
+	if c, ok := s.c.Services[name]; ok {
+		return c
+	}
+	return NewUnitConfig()
+}
+
+func (s *Supervisor) order() ([]*unit, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	byName := make(map[string]*unit, len(s.units))
+	for _, u := range s.units {
+		byName[u.name] = u
+	}
+	deps := make(map[string][]string, len(s.units))
+	for _, u := range s.units {
+		for _, dep := range append(slices.Clone(u.dependsOn), s.unitConfig(u.name).DependsOn...) {
+			if _, ok := byName[dep]; !ok {
+				s.logger.Warnf("service %v depends on %v which is not running, dependency ignored", u.name, dep)
+				continue
+			}
+			if !slices.Contains(deps[u.name], dep) {
+				deps[u.name] = append(deps[u.name], dep)
+			}
+		}
+	}
+
+	result := make([]*unit, 0, len(s.units))
+	added := make(map[string]bool, len(s.units))
+	for len(result) < len(s.units) {
+		progress := false
+		for _, u := range s.units {
+			if added[u.name] {
+				continue
+			}
+			if slices.ContainsFunc(deps[u.name], func(dep string) bool { return !added[dep] }) {
+				continue
+			}
+			added[u.name] = true
+			result = append(result, u)
+			progress = true
+		}
+		if !progress {
+			return nil, ErrCycle
+		}
+	}
+	return result, nil
+}
+
+var _ IService = (*Supervisor)(nil)
+
+func (s *Supervisor) Run() error {
+	if !s.started.CompareAndSwap(false, true) {
+		return fmt.Errorf("supervisor already started")
+	}
+	defer close(s.done)
+
+	order, err := s.order()
+	if err != nil {
+		return err
+	}
+
+	failCh := make(chan error, len(order))
+	started := make([]*unit, 0, len(order))
+	for _, u := range order {
+		if s.ctx.Err() != nil {
+			break
+		}
+		u.setState(StateStarting)
+		go s.supervise(u, failCh)
+		started = append(started, u)
+		if err = s.waitReady(u, failCh); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		allDone := make(chan struct{})
+		go func(units []*unit) {
+			for _, u := range units {
+				<-u.done
+			}
+			close(allDone)
+		}(slices.Clone(started))
+		select {
+		case <-s.ctx.Done():
+		case err = <-failCh:
+		case <-allDone:
+			select {
+			case err = <-failCh:
+			default:
+				s.logger.Info("all services finished")
+			}
+		}
+	}
+	s.cancel()
+
+	slices.Reverse(started)
+	for _, u := range started {
+		err = errors.Join(err, s.stopUnit(u))
+	}
+	return err
+}
+
+func (s *Supervisor) waitReady(u *unit, failCh <-chan error) error {
+	r, ok := u.svc.(IReadyNotifier)
+	if !ok {
+		return nil
+	}
+	t := time.NewTimer(s.c.StartTimeout)
+	defer t.Stop()
+	select {
+	case <-r.Ready():
+		s.logger.Infof("service %v is ready", u.name)
+		return nil
+	case err := <-failCh:
+		return err
+	case <-s.ctx.Done():
+		return nil
+	case <-t.C:
+		return fmt.Errorf("service %v: %w", u.name, ErrStartTimeout)
+	}
+}
+
+func (s *Supervisor) supervise(u *unit, failCh chan<- error) {
+	defer close(u.done)
+	c := s.unitConfig(u.name)
+	restart := c.Restart
+	if r, ok := u.svc.(IRestartable); restart && (!ok || !r.Restartable()) {
+		s.logger.Warnf("service %v can not be restarted, restart ignored", u.name)
+		restart = false
+	}
+	backoff := c.Backoff
+	for restarts := 0; ; restarts++ {
+		u.setState(StateRunning)
+		err := u.svc.Run()
+		if s.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			s.logger.Infof("service %v finished", u.name)
+			u.setState(StateStopped)
+			return
+		}
+		s.logger.WithError(err).Errorf("service %v failed", u.name)
+		if !restart || (c.MaxRestarts > 0 && restarts >= c.MaxRestarts) {
+			u.setState(StateFailed)
+			failCh <- fmt.Errorf("service %v: %w", u.name, err)
+			return
+		}
+
+		u.setState(StateRestarting)
+		s.logger.Infof("restart service %v in %s", u.name, backoff)
+		t := time.NewTimer(backoff)
+		select {
+		case <-s.ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		backoff = min(backoff*2, c.MaxBackoff)
+	}
+}
+
+func (s *Supervisor) stopUnit(u *unit) error {
+	timeout := s.unitConfig(u.name).StopTimeout
+	if timeout <= 0 {
+		timeout = s.c.StopTimeout
+		if p, ok := u.svc.(IStopTimeoutProvider); ok {
+			timeout = max(timeout, p.StopTimeout())
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	state := u.State()
+	if state == StateStopped || state == StateFailed {
+		return nil
+	}
+	u.setState(StateStopping)
+	s.logger.Infof("stop service %v", u.name)
+	err := u.svc.Stop(ctx)
+	select {
+	case <-u.done:
+	case <-ctx.Done():
+		err = errors.Join(err, fmt.Errorf("service %v: %w", u.name, ctx.Err()))
+	}
+	if err != nil {
+		u.setState(StateFailed)
+		return err
+	}
+	u.setState(StateStopped)
+	return nil
+}
+
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.cancel()
+	if !s.started.Load() {
+		return nil
+	}
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type testService struct {
+	name   string
+	events *[]string
+	m      *sync.Mutex
+	runs   int
+	fail   func(run int) error
+	stop   chan struct{}
+	ready  chan struct{}
+}
+
+func newTestService(name string, events *[]string, m *sync.Mutex) *testService {
+	return &testService{name: name, events: events, m: m, stop: make(chan struct{}), ready: make(chan struct{})}
+}
+
+func (s *testService) log(event string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	*s.events = append(*s.events, event+" "+s.name)
+}
+
+func (s *testService) Run() error {
+	s.runs++
+	s.log("run")
+	if s.fail != nil {
+		if err := s.fail(s.runs); err != nil {
+			return err
+		}
+	}
+	if s.runs == 1 {
+		close(s.ready)
+	}
+	<-s.stop
+	return nil
+}
+
+func (s *testService) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *testService) Stop(context.Context) error {
+	s.log("stop")
+	close(s.stop)
+	return nil
+}
+
+func TestSupervisor_Order(t *testing.T) {
+	var m sync.Mutex
+	events := make([]string, 0)
+	sv, err := NewSupervisor(
+		WithService("c", newTestService("c", &events, &m), "b"),
+		WithService("b", newTestService("b", &events, &m), "a"),
+		WithService("a", newTestService("a", &events, &m)),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	done := make(chan error)
+	go func() { done <- sv.Run() }()
+	assert.Eventually(t, func() bool {
+		return sv.Status()["c"] == StateRunning
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, sv.Stop(context.Background()))
+	assert.NoError(t, <-done)
+	assert.Equal(t, []string{"run a", "run b", "run c", "stop c", "stop b", "stop a"}, events)
+	assert.Equal(t, map[string]State{"a": StateStopped, "b": StateStopped, "c": StateStopped}, sv.Status())
+}
+
+func TestSupervisor_Cycle(t *testing.T) {
+	var m sync.Mutex
+	events := make([]string, 0)
+	sv, err := NewSupervisor(
+		WithService("a", newTestService("a", &events, &m), "b"),
+		WithService("b", newTestService("b", &events, &m), "a"),
+	)
+	if assert.NoError(t, err) {
+		assert.ErrorIs(t, sv.Run(), ErrCycle)
+	}
+}
+
+func TestSupervisor_FailureStopsAll(t *testing.T) {
+	var m sync.Mutex
+	events := make([]string, 0)
+	testErr := errors.New("test")
+	a := newTestService("a", &events, &m)
+	b := newTestService("b", &events, &m)
+	b.fail = func(int) error {
+		time.Sleep(10 * time.Millisecond)
+		return testErr
+	}
+	sv, err := NewSupervisor(WithService("a", a), WithService("b", b, "a"))
+	if assert.NoError(t, err) {
+		assert.ErrorIs(t, sv.Run(), testErr)
+		assert.Equal(t, map[string]State{"a": StateStopped, "b": StateFailed}, sv.Status())
+	}
+}
+
+type restartableService struct {
+	*testService
+}
+
+func (restartableService) Restartable() bool {
+	return true
+}
+
+func TestSupervisor_Restart(t *testing.T) {
+	var m sync.Mutex
+	events := make([]string, 0)
+	testErr := errors.New("test")
+	a := newTestService("a", &events, &m)
+	a.fail = func(run int) error {
+		if run < 3 {
+			return testErr
+		}
+		return nil
+	}
+	sv, err := NewSupervisor(
+		WithService("a", restartableService{a}),
+		config.WithReader[IService](config.NewMapReader(map[string]any{
+			"supervisor": map[string]any{
+				"services": map[string]any{
+					"a": map[string]any{"restart": true, "backoff": "1ms"},
+				},
+			},
+		})),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	done := make(chan error)
+	go func() { done <- sv.Run() }()
+	assert.Eventually(t, func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return len(events) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, sv.Stop(context.Background()))
+	assert.NoError(t, <-done)
+	assert.Equal(t, 3, a.runs)
+}
+
+func TestSupervisor_RestartUnsupported(t *testing.T) {
+	var m sync.Mutex
+	events := make([]string, 0)
+	testErr := errors.New("test")
+	a := newTestService("a", &events, &m)
+	a.fail = func(int) error { return testErr }
+	sv, err := NewSupervisor(
+		WithService("a", a),
+		config.WithReader[IService](config.NewMapReader(map[string]any{
+			"supervisor": map[string]any{
+				"services": map[string]any{
+					"a": map[string]any{"restart": true, "backoff": "1ms"},
+				},
+			},
+		})),
+	)
+	if assert.NoError(t, err) {
+		assert.ErrorIs(t, sv.Run(), testErr)
+		assert.Equal(t, 1, a.runs)
+	}
+}
+
+type finishingService struct{}
+
+func (finishingService) Run() error                 { return nil }
+func (finishingService) Stop(context.Context) error { return nil }
+
+func TestSupervisor_AllFinished(t *testing.T) {
+	sv, err := NewSupervisor(WithService("a", finishingService{}), WithService("b", finishingService{}, "a"))
+	if assert.NoError(t, err) {
+		assert.NoError(t, sv.Run())
+		assert.Equal(t, map[string]State{"a": StateStopped, "b": StateStopped}, sv.Status())
+	}
+}
+
+type slowStopService struct {
+	*testService
+	timeout  time.Duration
+	deadline time.Duration
+}
+
+func (s *slowStopService) StopTimeout() time.Duration {
+	return s.timeout
+}
+
+func (s *slowStopService) Stop(ctx context.Context) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		s.deadline = time.Until(deadline)
+	}
+	return s.testService.Stop(ctx)
+}
+
+func TestSupervisor_StopTimeoutProvider(t *testing.T) {
+	events, m := []string{}, &sync.Mutex{}
+	svc := &slowStopService{testService: newTestService("a", &events, m), timeout: time.Minute}
+	sv, err := NewSupervisor(WithService("a", svc))
+	if !assert.NoError(t, err) {
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- sv.Run() }()
+	<-svc.Ready()
+	assert.NoError(t, sv.Stop(context.Background()))
+	assert.NoError(t, <-done)
+	assert.Greater(t, svc.deadline, 50*time.Second)
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "example.com/analytics_api/pkg/tracing"
+
+// QueryHook starts a client span for every ClickHouse query; the span context
+// is also sent to the server, so ClickHouse can attach its own spans to it.
+type QueryHook struct {
+	tracer trace.Tracer
+}
+
+func NewQueryHook() *QueryHook {
+	return &QueryHook{
+		tracer: otel.Tracer(tracerName),
+	}
+}
+
+var _ ch.QueryHook = (*QueryHook)(nil)
+
+func (h *QueryHook) BeforeQuery(ctx context.Context, evt *ch.QueryEvent) context.Context {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemClickhouse,
+		semconv.DBQueryText(evt.Query),
+	}
+	if evt.DB != nil {
+		attrs = append(attrs, semconv.DBNamespace(evt.DB.Config().Database))
+	}
+	ctx, _ = h.tracer.Start(
+		ctx,
+		"clickhouse "+evt.Operation(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(evt.StartTime),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx
+}
+
+func (h *QueryHook) AfterQuery(ctx context.Context, evt *ch.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	if evt.Err != nil {
+		span.RecordError(evt.Err)
+		span.SetStatus(codes.Error, evt.Err.Error())
+	}
+	span.End()
+}
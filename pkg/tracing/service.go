@@ -0,0 +1,258 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/service"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+var exporters = []string{ExporterNone, ExporterOTLP, ExporterStdout, ExporterFile}
+
+type Config struct {
+	Exporter    string  `config:"exporter"`
+	Endpoint    string  `config:"endpoint"`
+	Insecure    bool    `config:"insecure"`
+	File        string  `config:"file"`
+	ServiceName string  `config:"service_name"`
+	SampleRatio float64 `config:"sample_ratio"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Exporter:    ExporterNone,
+		ServiceName: "analytics_api",
+		SampleRatio: 1,
+	}
+}
+
+func (c *Config) Read(cr config.IReader) error {
+	var err error
+	newC := *c
+
+	exporter, exporterErr := config.Get[string](cr, "exporter")
+	if exporterErr != nil && !errors.Is(exporterErr, config.ErrNotFound) {
+		err = errors.Join(err, exporterErr)
+	} else if exporterErr == nil {
+		newC.Exporter = exporter
+	}
+
+	endpoint, endpointErr := config.Get[string](cr, "endpoint")
+	if endpointErr != nil && !errors.Is(endpointErr, config.ErrNotFound) {
+		err = errors.Join(err, endpointErr)
+	} else if endpointErr == nil {
+		newC.Endpoint = endpoint
+	}
+
+	insecure, insecureErr := config.Get[bool](cr, "insecure")
+	if insecureErr != nil && !errors.Is(insecureErr, config.ErrNotFound) {
+		err = errors.Join(err, insecureErr)
+	} else if insecureErr == nil {
+		newC.Insecure = insecure
+	}
+
+	file, fileErr := config.Get[string](cr, "file")
+	if fileErr != nil && !errors.Is(fileErr, config.ErrNotFound) {
+		err = errors.Join(err, fileErr)
+	} else if fileErr == nil {
+		newC.File = file
+	}
+
+	serviceName, serviceNameErr := config.Get[string](cr, "service_name")
+	if serviceNameErr != nil && !errors.Is(serviceNameErr, config.ErrNotFound) {
+		err = errors.Join(err, serviceNameErr)
+	} else if serviceNameErr == nil {
+		newC.ServiceName = serviceName
+	}
+
+	sampleRatio, sampleRatioErr := getFloat(cr, "sample_ratio")
+	if sampleRatioErr != nil && !errors.Is(sampleRatioErr, config.ErrNotFound) {
+		err = errors.Join(err, sampleRatioErr)
+	} else if sampleRatioErr == nil {
+		newC.SampleRatio = sampleRatio
+	}
+
+	if err == nil && !slices.Contains(exporters, newC.Exporter) {
+		err = fmt.Errorf("unknown tracing exporter %q", newC.Exporter)
+	}
+	if err == nil && newC.Exporter == ExporterFile && newC.File == "" {
+		err = errors.New("tracing file exporter requires file")
+	}
+	if err == nil && (newC.SampleRatio < 0 || newC.SampleRatio > 1) {
+		err = fmt.Errorf("tracing sample ratio must be in [0, 1], got %v", newC.SampleRatio)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*c = newC
+	return nil
+}
+
+func getFloat(cr config.IReader, key string) (float64, error) {
+	if v, err := config.Get[int](cr, key); err == nil {
+		return float64(v), nil
+	}
+	return config.Get[float64](cr, key)
+}
+
+type tracingService struct {
+	c        *Config
+	logger   *log.Logger
+	m        sync.Mutex
+	provider *sdktrace.TracerProvider
+	closer   io.Closer
+	ready    chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewService(opts ...service.Opt) (service.IService, error) {
+	s := &tracingService{
+		c:      NewConfig(),
+		logger: log.StandardLogger(),
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+var _ service.ILogWriter = (*tracingService)(nil)
+
+func (s *tracingService) SetLogger(l *log.Logger) error {
+	s.logger = l
+	return nil
+}
+
+var _ config.IConfigurable = (*tracingService)(nil)
+
+func (s *tracingService) Configure(cr config.IReader) error {
+	tracingCr, found := cr.Sub("tracing")
+	if !found {
+		return nil
+	}
+	return s.c.Read(tracingCr)
+}
+
+var _ config.ISchemaProvider = (*tracingService)(nil)
+
+func (s *tracingService) Schema() *config.Schema {
+	return config.SchemaOf(NewConfig())
+}
+
+var _ service.IReadyNotifier = (*tracingService)(nil)
+
+func (s *tracingService) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *tracingService) Run() error {
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	)
+	if s.c.Exporter != ExporterNone {
+		provider, err := s.newProvider()
+		if err != nil {
+			return err
+		}
+		otel.SetTracerProvider(provider)
+		s.logger.Infof("tracing enabled, exporter %v", s.c.Exporter)
+	}
+	select {
+	case <-s.ready:
+	default:
+		close(s.ready)
+	}
+	<-s.done
+	return nil
+}
+
+func (s *tracingService) newProvider() (*sdktrace.TracerProvider, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.provider != nil {
+		return s.provider, nil
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch s.c.Exporter {
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if s.c.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(s.c.Endpoint))
+		}
+		if s.c.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterFile:
+		f, openErr := os.OpenFile(s.c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if openErr != nil {
+			return nil, openErr
+		}
+		s.closer = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(s.c.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(s.c.ServiceName),
+		)),
+	)
+	return s.provider, nil
+}
+
+func (s *tracingService) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.done) })
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	var err error
+	if s.provider != nil {
+		err = errors.Join(err, s.provider.Shutdown(ctx))
+		s.provider = nil
+	}
+	if s.closer != nil {
+		err = errors.Join(err, s.closer.Close())
+		s.closer = nil
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/analytics_api/pkg/config"
+	"example.com/analytics_api/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestConfig_Read(t *testing.T) {
+	c := NewConfig()
+	assert.NoError(t, c.Read(config.NewMapReader(map[string]any{
+		"exporter":     "otlp",
+		"endpoint":     "http://collector:4318",
+		"sample_ratio": 0.5,
+	})))
+	assert.Equal(t, ExporterOTLP, c.Exporter)
+	assert.Equal(t, 0.5, c.SampleRatio)
+
+	for name, m := range map[string]map[string]any{
+		"unknown exporter":  {"exporter": "zipkin"},
+		"file without path": {"exporter": "file"},
+		"bad ratio":         {"sample_ratio": 2},
+	} {
+		c := NewConfig()
+		assert.Error(t, c.Read(config.NewMapReader(m)), name)
+		assert.Equal(t, NewConfig(), c, name)
+	}
+}
+
+func TestService_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	s, err := NewService(config.WithReader[service.IService](config.NewMapReader(map[string]any{
+		"tracing": map[string]any{
+			"exporter": "file",
+			"file":     path,
+		},
+	})))
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run() }()
+	select {
+	case <-s.(service.IReadyNotifier).Ready():
+	case <-time.After(time.Second):
+		t.Fatal("tracing service is not ready")
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+
+	assert.NoError(t, s.Stop(context.Background()))
+	assert.NoError(t, <-errCh)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), `"Name":"test-span"`))
+}